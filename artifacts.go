@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Files needed to restore a server on new hardware, such as its
+// etc\dbpath.properties, are collected with the backups when the job
+// lists them in Artifacts. Each is a pattern relative to the install or db
+// folder of the job's server, see jobServer:
+//
+//	Artifacts = "install:etc/*.properties, install:etc/*.xml, db:logs/*.log"
+//
+// They are copied to the artifacts folder of BackupFolder and of the
+// archive, e.g. artifacts/install/etc/dbpath.properties.
+
+// artifactsFolder is the folder of the artifacts in BackupFolder and the
+// archive
+const artifactsFolder = "artifacts"
+
+// artifactPattern is a pattern of Artifacts
+type artifactPattern struct {
+	Base    string // install or db
+	Pattern string // slash separated pattern in the base folder
+}
+
+func (p artifactPattern) String() string {
+	return p.Base + ":" + p.Pattern
+}
+
+// artifact is a file matched by Artifacts
+type artifact struct {
+	Path string // file on this computer
+	Name string // slash separated name in the artifacts folder
+}
+
+// parseArtifacts splits the comma separated patterns of Artifacts
+func parseArtifacts(s string) ([]artifactPattern, error) {
+
+	var patterns []artifactPattern
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		base, pattern, ok := strings.Cut(item, ":")
+		base = strings.ToLower(base)
+		if !ok || base != "install" && base != "db" {
+			return nil, fmt.Errorf("%q does not start with install: or db:", item)
+		}
+
+		pattern = path.Clean(strings.ReplaceAll(strings.TrimSpace(pattern), `\`, "/"))
+		switch {
+		case pattern == "." || path.IsAbs(pattern) || filepath.IsAbs(pattern):
+			return nil, fmt.Errorf("%q is not a pattern relative to the %s folder", item, base)
+		case pattern == ".." || strings.HasPrefix(pattern, "../"):
+			return nil, fmt.Errorf("%q is outside the %s folder", item, base)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q is not a valid pattern", item)
+		}
+		patterns = append(patterns, artifactPattern{base, pattern})
+	}
+	return patterns, nil
+}
+
+// getArtifacts returns the files matched by Artifacts
+func (config *configSettings) getArtifacts() ([]artifact, error) {
+
+	patterns, err := parseArtifacts(config.Artifacts)
+	if err != nil || len(patterns) == 0 {
+		return nil, err
+	}
+
+	es, err := config.jobServer()
+	if err != nil {
+		return nil, fmt.Errorf("Artifacts: %v", err)
+	}
+
+	var artifacts []artifact
+	seen := map[string]bool{}
+	for _, p := range patterns {
+		dir := es.InstallPath()
+		if p.Base == "db" {
+			if dir, err = es.DBPath(); err != nil {
+				return nil, fmt.Errorf("Artifacts: db folder of `%s`: %v", es.name, err)
+			}
+		}
+		if dir == "" {
+			return nil, fmt.Errorf("Artifacts: `%s` has no %s folder", es.name, p.Base)
+		}
+
+		matches, err := filepath.Glob(filepath.Join(dir, filepath.FromSlash(p.Pattern)))
+		if err != nil {
+			return nil, fmt.Errorf("Artifacts: %s: %v", p, err)
+		}
+		found := 0
+		for _, file := range matches {
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return nil, err
+			}
+			name := p.Base + "/" + filepath.ToSlash(rel)
+			if !isFile(file) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			found++
+			artifacts = append(artifacts, artifact{Path: file, Name: name})
+		}
+		if found == 0 {
+			log.Printf("warning: Artifacts: no files match %s in %s\n", p, dir)
+		}
+	}
+	return artifacts, nil
+}
+
+// checkArtifactsFolder tests that no backup is collected in the artifacts
+// folder of BackupFolder or the archive, such as those of a server folder
+// named artifacts with PreserveStructure
+func (config *configSettings) checkArtifactsFolder(files []string) error {
+
+	if config.Artifacts == "" {
+		return nil
+	}
+	for _, file := range files {
+		for _, name := range []string{config.backupTarget(file), config.archiveEntry(file)} {
+			if dir, _, ok := strings.Cut(name, "/"); ok && strings.EqualFold(dir, artifactsFolder) {
+				return fmt.Errorf("Artifacts: backup `%s` would be collected as `%s` in the artifacts folder, rename the server folder or its FriendlyName", file, name)
+			}
+		}
+	}
+	return nil
+}
+
+// collectArtifacts replaces the artifacts folder of BackupFolder with the
+// artifacts, as the files may change without their names changing. the
+// folder is left alone when the job has no Artifacts.
+func (config *configSettings) collectArtifacts(artifacts []artifact) error {
+
+	if config.Artifacts == "" {
+		return nil
+	}
+	dir := filepath.Join(config.BackupFolder, artifactsFolder)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	for _, a := range artifacts {
+		log.Printf("copying artifact `%s`\n", a.Name)
+		dest := filepath.Join(dir, filepath.FromSlash(a.Name))
+		if err := os.MkdirAll(filepath.Dir(dest), fs.ModePerm|fs.ModeDir); err != nil {
+			return err
+		}
+		if err := copyFile(dest, a.Path); err != nil {
+			return err
+		}
+		if err := copyInfo(dest, a.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printArtifacts prints the artifacts of the job after its backups
+func (config *configSettings) printArtifacts() {
+
+	if config.Artifacts == "" {
+		return
+	}
+	artifacts, err := config.getArtifacts()
+	if err != nil {
+		log.Printf("Error listing artifacts: %v\n", err)
+		return
+	}
+	fmt.Println("# artifacts")
+	for _, a := range artifacts {
+		fmt.Printf("%s  # %s/%s\n", a.Path, artifactsFolder, a.Name)
+	}
+}
@@ -1,78 +1,612 @@
 package main
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"log"
-	"os"
+	"reflect"
 	"strconv"
 	"strings"
 )
 
+// configSettings are the settings of a backup job
 type configSettings struct {
-	ESBackupPath    string
-	BackupFolder    string
-	ArchiveFolder   string
-	ArchiveName     string
-	Archive         bool
-	ArchiveCount    int
-	ArchiveAddYear  bool
-	ArchiveAddMonth bool
-	ArchiveISOWeek  bool
-	ArchiveWeekday  bool
-	Ftp             bool
-	FtpAddYear      bool
-	FtpAddMonth     bool
-	FtpName         string
-	FtpUri          string
-	FtpUser         string
-	FtpPass         string
-	FtpWeekday      string
+	Name string // job name, empty for a config without job sections
+
+	ESBackupPath        string
+	ServerKind          string
+	BackupFolder        string
+	BackupCount         int
+	BackupNewerThan     string
+	BackupInclude       string
+	BackupExclude       string
+	BackupTime          string
+	BackupTimeTolerance string
+	BackupTimeFormat    string
+	MaxBackupAge        string
+	PreserveStructure   bool
+	Artifacts           string
+	ArchiveFolder       string
+	ArchiveName         string
+	Archive             bool
+	ArchiveCount        int
+	ArchiveAddYear      bool
+	ArchiveAddMonth     bool
+	ArchiveISOWeek      bool
+	ArchiveWeekday      bool
+	Ftp                 bool
+	FtpAddYear          bool
+	FtpAddMonth         bool
+	FtpName             string
+	FtpUri              string
+	FtpUser             string
+	FtpPass             secret
+	FtpWeekday          string
+
+	// servers are the settings of the server folders in ESBackupPath
+	servers []*serverSettings
+
+	// stale are the stale servers found by the last run
+	stale []staleServer
+
+	// sources records where each setting was taken from
+	sources map[string]valueSource
 }
 
-func parseConfig(file []byte) configSettings {
+// settings is a struct the settings of a schema are loaded into
+type settings interface {
+	setSource(name string, s valueSource)
+}
 
-	settings := map[string]string{}
-	lines := bytes.Split(file, []byte{'\n'})
+// valueSource is where the value of a setting was taken from
+type valueSource struct {
+	Kind string // default, file, env or flag
+	File string // config file for file values
+	Line int    // line in the config file
+	Name string // environment variable or flag name
+}
 
-	for _, line := range lines {
-		kv := bytes.Split(line, []byte{'='})
-		if len(kv) == 2 {
-			val := string(bytes.Trim(bytes.Split(kv[1], []byte{'#'})[0], "\" \n\r"))
-			settings[string(bytes.ToLower(bytes.TrimSpace(kv[0])))] = val
-		}
+func (s valueSource) String() string {
+	switch s.Kind {
+	case "file":
+		return fmt.Sprintf("%s:%d", s.File, s.Line)
+	case "env", "flag":
+		return fmt.Sprintf("%s %s", s.Kind, s.Name)
+	}
+	return s.Kind
+}
+
+// source returns where the setting was taken from
+func (config *configSettings) source(name string) valueSource {
+	if s, ok := config.sources[name]; ok {
+		return s
+	}
+	return valueSource{Kind: "default"}
+}
+
+func (config *configSettings) setSource(name string, s valueSource) {
+	if config.sources == nil {
+		config.sources = map[string]valueSource{}
+	}
+	config.sources[name] = s
+}
+
+type fieldType int
+
+const (
+	fieldString fieldType = iota
+	fieldBool
+	fieldInt
+	fieldSecret // a string that may refer to its value, see secret
+	fieldPath   // a string expanded when loaded, see expandPath
+)
+
+func (t fieldType) String() string {
+	switch t {
+	case fieldBool:
+		return "bool"
+	case fieldInt:
+		return "int"
 	}
+	return "string"
+}
+
+// configField describes a setting of the config file. Name matches the
+// configSettings field it is loaded into.
+type configField struct {
+	Name    string
+	Type    fieldType
+	Default string
+	Desc    string
+}
 
-	config := configSettings{
-		ESBackupPath: settings["esbackuppath"],
-		BackupFolder: settings["backupfolder"],
+// configVersion is the version of the config file layout written by this
+// version of the tool. files from older versions are upgraded with
+// `config migrate`.
+const configVersion = 2
 
-		Archive:         strings.ToLower(settings["archive"]) == "true",
-		ArchiveFolder:   settings["archivefolder"],
-		ArchiveName:     settings["archivename"],
-		ArchiveAddYear:  strings.ToLower(settings["archiveaddyear"]) == "true",
-		ArchiveAddMonth: strings.ToLower(settings["archiveaddmonth"]) == "true",
-		ArchiveISOWeek:  strings.ToLower(settings["archiveisoweek"]) == "true",
+// versionKey records the layout version in the config file
+const versionKey = "ConfigVersion"
+
+// configFields is the schema of the config file in the order the
+// settings are written to a new config file
+var configFields = []configField{
+	{"ESBackupPath", fieldPath, "", "path to the ES backups 'db_backup'"},
+	{"ServerKind", fieldString, "es", "kind of server to back up: es for Enterprise Server, ec for Enterprise Central"},
+	{"BackupFolder", fieldPath, "", "the path to copy the backups to"},
+	{"BackupCount", fieldInt, "1", "number of the newest backups of each server to collect, 0 for no limit"},
+	{"BackupNewerThan", fieldString, "", "only collect backups newer than this, e.g. 36h, 14d or 2w"},
+	{"BackupInclude", fieldString, "", "only collect backups whose names match one of these comma separated patterns"},
+	{"BackupExclude", fieldString, "", "do not collect backups whose names match one of these comma separated patterns"},
+	{"BackupTime", fieldString, "", "for each day only collect the backup taken nearest to this time of day, e.g. 02:00"},
+	{"BackupTimeTolerance", fieldString, "1h", "do not collect backups taken further than this from BackupTime"},
+	{"BackupTimeFormat", fieldString, "", "time in the backup names used by BackupTime, e.g. yyyyMMdd_HHmmss, the modification time if empty"},
+	{"MaxBackupAge", fieldString, "", "report servers whose newest backup is older than this as stale, e.g. 2d"},
+	{"PreserveStructure", fieldBool, "false", "keep the backups of each server in a folder named after its folder in ESBackupPath"},
+	{"Artifacts", fieldString, "", "files to collect with the backups, comma separated patterns such as install:etc/*.properties or db:logs/*.log"},
+	{"Archive", fieldBool, "false", "flag to create archive file"},
+	{"ArchiveCount", fieldInt, "0", "number of archive files to keep, 0 keeps all"},
+	{"ArchiveFolder", fieldPath, "", "the path to save an archive zip of all the backups"},
+	{"ArchiveName", fieldString, "", "name of the archive file, may be a template such as {name}_{isoyear}W{isoweek}"},
+	{"ArchiveISOWeek", fieldBool, "false", "add ISO week number to the archive name"},
+	{"ArchiveWeekday", fieldBool, "false", "add weekday to the archive name"},
+	{"ArchiveAddYear", fieldBool, "false", "add year to the archive name"},
+	{"ArchiveAddMonth", fieldBool, "false", "add month to the archive name"},
+	{"Ftp", fieldBool, "false", "flag to upload to an ftp server"},
+	{"FtpName", fieldString, "", "name of the uploaded file, ArchiveName if empty, may be a template"},
+	{"FtpAddYear", fieldBool, "false", "add year to the uploaded file name"},
+	{"FtpAddMonth", fieldBool, "false", "add month to the uploaded file name"},
+	{"FtpUri", fieldString, "", "URI of the ftp server"},
+	{"FtpUser", fieldString, "", "ftp user name"},
+	{"FtpPass", fieldSecret, "", "ftp password, or env:NAME, file:PATH or an enc: value from the secret set command"},
+	{"FtpWeekday", fieldString, "", "day to upload the file: sunday, monday, ... saturday"},
+}
+
+// lookupField finds the schema entry for a key. keys are not case sensitive.
+func lookupField(key string) *configField {
+	return findField(configFields, key)
+}
 
-		Ftp:        strings.ToLower(settings["ftp"]) == "true",
-		FtpUri:     settings["ftpuri"],
-		FtpUser:    settings["ftpuser"],
-		FtpPass:    settings["ftppass"],
-		FtpWeekday: settings["ftpweekday"],
+// findField finds the entry for a key in a schema
+func findField(fields []configField, key string) *configField {
+	for i := range fields {
+		if strings.EqualFold(fields[i].Name, key) {
+			return &fields[i]
+		}
 	}
+	return nil
+}
+
+// set parses the value and stores it in the config
+func (f *configField) set(config settings, value string) error {
+
+	v := reflect.ValueOf(config).Elem().FieldByName(f.Name)
+
+	switch f.Type {
+	case fieldBool:
+		if value == "" {
+			value = f.Default
+		}
+		b, err := strconv.ParseBool(strings.ToLower(value))
+		if err != nil {
+			return fmt.Errorf("%s: %q is not true or false", f.Name, value)
+		}
+		v.SetBool(b)
+
+	case fieldInt:
+		if value == "" {
+			value = f.Default
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", f.Name, value)
+		}
+		v.SetInt(int64(n))
+
+	case fieldSecret:
+		v.Set(reflect.ValueOf(secret{Ref: value}))
 
-	if sc, ok := settings["archivecount"]; ok {
-		config.ArchiveCount, _ = strconv.Atoi(sc)
+	default:
+		v.SetString(value)
 	}
+	return nil
+}
 
+// get returns the value of the field in the config as text. secrets are
+// masked.
+func (f *configField) get(config settings) string {
+	return fmt.Sprint(reflect.ValueOf(config).Elem().FieldByName(f.Name).Interface())
+}
+
+// defaultConfig returns the settings used for keys missing from the config file
+func defaultConfig() configSettings {
+	var config configSettings
+	for i := range configFields {
+		f := &configFields[i]
+		if err := f.set(&config, f.Default); err != nil {
+			panic(err)
+		}
+	}
 	return config
 }
 
-func loadConfig(configFile string) configSettings {
+// parseConfig loads the jobs from the config file contents, see
+// parseConfigDocs. included files are not read.
+func parseConfig(name string, file []byte) ([]*configSettings, []*configError, error) {
+
+	doc, err := parseConfigDoc(name, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseConfigDocs([]*configDoc{doc})
+}
+
+// docLine is a line with the file it was read from
+type docLine struct {
+	doc  *configDoc
+	line *configLine
+}
+
+// serverKey is a server section, of a job or of every job
+type serverKey struct {
+	job    string
+	server string
+}
+
+// parseSectionName returns the job and server of a section header:
+// [job.NAME], [server.NAME] or [job.NAME.server.NAME]
+func parseSectionName(section []string) (job, server string, ok bool) {
+	switch {
+	case len(section) == 2 && strings.EqualFold(section[0], "job"):
+		return section[1], "", true
+	case len(section) == 2 && strings.EqualFold(section[0], "server"):
+		return "", section[1], true
+	case len(section) == 4 && strings.EqualFold(section[0], "job") && strings.EqualFold(section[2], "server"):
+		return section[1], section[3], true
+	}
+	return "", "", false
+}
+
+// sectionFields returns the schema of the keys in a section
+func sectionFields(section []string) []configField {
+	if _, server, ok := parseSectionName(section); ok && server != "" {
+		return serverFields
+	}
+	return configFields
+}
+
+// parseConfigDocs loads the jobs from config files given in the order they
+// apply. keys before the first [job.NAME] section apply to every job and
+// are overridden by the job sections of any file, and among the keys at
+// the top or the keys of a job a later file overrides an earlier one. the
+// keys of jobs with the same name are merged, and files without job
+// sections are a single job. [server.NAME] sections apply to the server in
+// every job and are overridden by [job.NAME.server.NAME]. unknown keys and
+// keys repeated in a file are returned as warnings.
+func parseConfigDocs(docs []*configDoc) ([]*configSettings, []*configError, error) {
 
-	file, e := os.ReadFile(configFile)
-	if e != nil {
-		log.Fatal(e)
+	var errs []error
+	var warnings []*configError
+	warned := map[configError]bool{}
+	warn := func(w *configError) {
+		// the top of a file is applied to every job, warn once
+		if !warned[*w] {
+			warned[*w] = true
+			warnings = append(warnings, w)
+		}
 	}
-	return parseConfig(file)
 
+	// sort the key lines into the top of the files, each job and each
+	// server
+	var top []docLine
+	var names, serverNames []string
+	jobLines := map[string][]docLine{}
+	serverLines := map[serverKey][]docLine{}
+
+	for _, doc := range docs {
+		headers := map[string]bool{}
+		var current serverKey
+		valid := true
+
+		for _, line := range doc.Lines {
+			if line.Header {
+				job, server, ok := parseSectionName(line.Section)
+				valid = ok
+				if !valid {
+					errs = append(errs, &configError{doc.Name, line.Num, fmt.Sprintf("unknown section %s, expected [job.NAME], [server.NAME] or [job.NAME.server.NAME]", strings.TrimSpace(line.Raw))})
+					continue
+				}
+				header := strings.ToLower(strings.Join(line.Section, "."))
+				if headers[header] {
+					msg := fmt.Sprintf("job %q is repeated", job)
+					if server != "" {
+						msg = fmt.Sprintf("section %s is repeated", strings.TrimSpace(line.Raw))
+					}
+					errs = append(errs, &configError{doc.Name, line.Num, msg})
+					valid = false
+					continue
+				}
+				headers[header] = true
+
+				current = serverKey{strings.ToLower(job), strings.ToLower(server)}
+				if _, ok := jobLines[current.job]; !ok && job != "" {
+					names = append(names, job)
+					jobLines[current.job] = nil
+				}
+				if _, ok := serverLines[serverKey{"", current.server}]; !ok && server != "" {
+					serverNames = append(serverNames, server)
+					serverLines[serverKey{"", current.server}] = nil
+				}
+				continue
+			}
+
+			if line.Warning != "" {
+				warn(&configError{doc.Name, line.Num, line.Warning})
+			}
+			if line.Key == "" || !valid {
+				continue
+			}
+			switch {
+			case line.Section == nil:
+				top = append(top, docLine{doc, line})
+			case current.server == "":
+				jobLines[current.job] = append(jobLines[current.job], docLine{doc, line})
+			default:
+				serverLines[current] = append(serverLines[current], docLine{doc, line})
+			}
+		}
+	}
+
+	type fileKey struct {
+		doc   *configDoc
+		field *configField
+	}
+
+	apply := func(config settings, fields []configField, lines []docLine) {
+		seen := map[fileKey]int{}
+		for _, l := range lines {
+			name, line := l.doc.Name, l.line
+
+			if line.Section == nil && (strings.EqualFold(line.Key, versionKey) || isIncludeKey(line.Key)) {
+				continue
+			}
+
+			f := findField(fields, line.Key)
+			if f == nil {
+				msg := fmt.Sprintf("unknown key %q", line.Key)
+				if s := suggestField(fields, line.Key); s != "" {
+					msg = fmt.Sprintf("%s, did you mean %q?", msg, s)
+				}
+				warn(&configError{name, line.Num, msg})
+				continue
+			}
+
+			if prev, ok := seen[fileKey{l.doc, f}]; ok {
+				msg := fmt.Sprintf("%s is repeated, overrides the value from line %d", f.Name, prev)
+				warn(&configError{name, line.Num, msg})
+			}
+			seen[fileKey{l.doc, f}] = line.Num
+
+			if err := f.set(config, line.Value); err != nil {
+				e := &configError{name, line.Num, err.Error()}
+				if !warned[*e] {
+					warned[*e] = true
+					errs = append(errs, e)
+				}
+			}
+			config.setSource(f.Name, valueSource{Kind: "file", File: name, Line: line.Num})
+		}
+	}
+
+	for _, l := range top {
+		if !strings.EqualFold(l.line.Key, versionKey) {
+			continue
+		}
+		v, err := strconv.Atoi(l.line.Value)
+		switch {
+		case err != nil:
+			errs = append(errs, &configError{l.doc.Name, l.line.Num, fmt.Sprintf("%s: %q is not a number", versionKey, l.line.Value)})
+		case v > configVersion:
+			warnings = append(warnings, &configError{l.doc.Name, l.line.Num, fmt.Sprintf("%s %d is newer than this version of %s supports", versionKey, v, exeName)})
+		}
+	}
+
+	// servers applies the [server.NAME] sections, then those of the job
+	servers := func(job string) []*serverSettings {
+		var list []*serverSettings
+		for _, name := range serverNames {
+			key := serverKey{job, strings.ToLower(name)}
+			server := defaultServer(name)
+			apply(server, serverFields, serverLines[serverKey{"", key.server}])
+			if job != "" {
+				apply(server, serverFields, serverLines[key])
+			}
+			if server.sources != nil {
+				list = append(list, server)
+			}
+		}
+		return list
+	}
+
+	// the keys at the top of every file apply first, then the job sections,
+	// so a job section of a base file is not overridden by the top of the
+	// including file
+	var jobs []*configSettings
+	for _, name := range names {
+		job := defaultConfig()
+		job.Name = name
+		apply(&job, configFields, top)
+		apply(&job, configFields, jobLines[strings.ToLower(name)])
+		job.servers = servers(strings.ToLower(name))
+		jobs = append(jobs, &job)
+	}
+
+	if len(jobs) == 0 {
+		base := defaultConfig()
+		apply(&base, configFields, top)
+		base.servers = servers("")
+		jobs = append(jobs, &base)
+	}
+	return jobs, warnings, errors.Join(errs...)
+}
+
+// findJob returns the job with the name. names are not case sensitive.
+func findJob(jobs []*configSettings, name string) *configSettings {
+	for _, job := range jobs {
+		if strings.EqualFold(job.Name, name) {
+			return job
+		}
+	}
+	return nil
+}
+
+// jobName is the name of the job for messages
+func (config *configSettings) jobName() string {
+	if config.Name == "" {
+		return "default"
+	}
+	return config.Name
+}
+
+// suggestField returns the field name closest to a misspelled key, or an
+// empty string if nothing is close
+func suggestField(fields []configField, key string) string {
+	best, bestDist := "", 3
+	for _, f := range fields {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(f.Name)); d < bestDist {
+			best, bestDist = f.Name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// readConfig reads the config file, applies the environment and command
+// line overrides, expands the paths and returns the jobs with any
+// warnings. only the job selected with --job is returned.
+func readConfig(configFile string) ([]*configSettings, []*configError, error) {
+
+	docs, err := loadConfigDocs(configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jobs, warnings, err := parseConfigDocs(docs)
+	if err != nil {
+		return nil, warnings, err
+	}
+
+	// every job is checked against the others, even when one is selected,
+	// as jobs sharing a folder delete each other's files
+	if err := checkJobFolders(definedFolders(jobs)); err != nil {
+		return nil, warnings, err
+	}
+	if selectedJob != "" {
+		job := findJob(jobs, selectedJob)
+		if job == nil {
+			return nil, warnings, fmt.Errorf("job %q not found in %s", selectedJob, configFile)
+		}
+		jobs = []*configSettings{job}
+	}
+
+	// the overrides are for a one-off run of a single job
+	switch names := overrideNames(); {
+	case len(jobs) == 1:
+		if err := jobs[0].applyOverrides(); err != nil {
+			return nil, warnings, err
+		}
+	case len(names) > 0:
+		warnings = append(warnings, &configError{configFile, 0, fmt.Sprintf("%s ignored, select the job to change with --job", strings.Join(names, ", "))})
+	}
+
+	for _, job := range jobs {
+		if err := job.expandPaths(); err != nil {
+			return nil, warnings, fmt.Errorf("job `%s`: %v", job.jobName(), err)
+		}
+	}
+	return jobs, warnings, nil
+}
+
+// definedFolders returns the jobs with their paths expanded as the config
+// file defines them, without the overrides. a job whose paths do not
+// expand is left out.
+func definedFolders(jobs []*configSettings) []*configSettings {
+	var list []*configSettings
+	for _, job := range jobs {
+		c := *job
+		if c.expandPaths() == nil {
+			list = append(list, &c)
+		}
+	}
+	return list
+}
+
+// loadConfig reads the config file and logs any warnings
+func loadConfig(configFile string) ([]*configSettings, error) {
+
+	jobs, warnings, err := readConfig(configFile)
+	for _, w := range warnings {
+		log.Printf("warning: %v\n", w)
+	}
+	return jobs, err
+}
+
+// writeConfig writes the settings as a config file with a comment
+// describing each setting
+func writeConfig(w io.Writer, config *configSettings) error {
+	_, err := fmt.Fprintf(w, "%-17s = %d  # version of the config file layout\n", versionKey, configVersion)
+	if err != nil {
+		return err
+	}
+	for i := range configFields {
+		f := &configFields[i]
+		value := f.get(config)
+		if f.Type == fieldSecret {
+			value, err = reflect.ValueOf(config).Elem().FieldByName(f.Name).Interface().(secret).persist()
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, formatConfigLine(f, value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatConfigLine formats a setting as a line of the config file
+func formatConfigLine(f *configField, value string) string {
+	return fmt.Sprintf("%-17s = %s  # %s", f.Name, formatConfigValue(f, value), f.Desc)
+}
+
+// formatConfigValue quotes string values so they read back unchanged
+func formatConfigValue(f *configField, value string) string {
+	if f.Type != fieldString && f.Type != fieldSecret && f.Type != fieldPath {
+		return value
+	}
+	if strings.Contains(value, `"`) {
+		return "'" + value + "'"
+	}
+	return `"` + value + `"`
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// selectJob runs readConfig for the job as --job would
+func selectJob(t *testing.T, name string) {
+	t.Helper()
+	job := selectedJob
+	selectedJob = name
+	t.Cleanup(func() { selectedJob = job })
+}
+
+func TestReadConfigOverrides(t *testing.T) {
+
+	dir := writeConfigFiles(t, map[string]string{
+		"jobs.config": "[job.a]\nBackupFolder = /out/a\n[job.b]\nBackupFolder = /out/b\n",
+		"one.config":  "BackupFolder = /out/one\n",
+	})
+	jobs := filepath.Join(dir, "jobs.config")
+	t.Setenv("EBOBACKUP_BACKUPFOLDER", "/out/a")
+
+	// a one-off folder for the job run may be that of another job
+	selectJob(t, "b")
+	list, _, err := readConfig(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].BackupFolder != "/out/a" {
+		t.Errorf("--job b: got %d jobs, BackupFolder %q", len(list), list[0].BackupFolder)
+	}
+
+	// the overrides are ignored when several jobs run
+	selectJob(t, "")
+	list, warnings, err := readConfig(jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list[0].BackupFolder != "/out/a" || list[1].BackupFolder != "/out/b" {
+		t.Errorf("every job: BackupFolder %q and %q", list[0].BackupFolder, list[1].BackupFolder)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "EBOBACKUP_BACKUPFOLDER ignored") {
+		t.Errorf("got warnings %v", warnings)
+	}
+
+	// and applied to the only job
+	list, _, err = readConfig(filepath.Join(dir, "one.config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list[0].BackupFolder != "/out/a" {
+		t.Errorf("only job: BackupFolder %q", list[0].BackupFolder)
+	}
+}
+
+func TestReadConfigSharedFolder(t *testing.T) {
+
+	dir := writeConfigFiles(t, map[string]string{
+		"site.config": "[job.a]\nBackupFolder = /out\n[job.b]\nBackupFolder = /out/b\n",
+	})
+
+	// the file is rejected even when the job run has its own folder
+	selectJob(t, "b")
+	t.Setenv("EBOBACKUP_BACKUPFOLDER", "/elsewhere")
+	_, _, err := readConfig(filepath.Join(dir, "site.config"))
+	if err == nil || !strings.Contains(err.Error(), "is inside that of job `a`") {
+		t.Errorf("got error %v, want job b inside job a", err)
+	}
+}
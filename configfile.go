@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The config file is a list of `Key = Value` lines. Blank lines and lines
+// starting with '#' are ignored, and a '#' after a value starts a comment.
+// A `[section]` line starts a section; the keys that follow belong to it.
+//
+// Lines that are not `Key = Value`, such as a note written without '#', are
+// ignored with a warning, as older versions ignored them silently.
+//
+// Values may be bare or quoted. Quoted values are taken literally, so
+// Windows paths such as "C:\ProgramData\" need no escaping. A value that
+// contains a double quote can be written with single quotes instead.
+//
+//	ESBackupPath = "C:\ProgramData\Schneider Electric EcoStruxure\Building Operation 6.0\Enterprise Server\db_backup"
+//	Archive      = True   # create an archive
+//	FtpPass      = 'pa"ss=word'
+//
+//	[job."Building Operation 6.0"]
+//	BackupFolder = "D:\ebobackup\es60"
+
+// configError is a problem found at a line of a config file
+type configError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *configError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// configLine is a single line of a config file
+type configLine struct {
+	Num     int      // line number starting at 1
+	Raw     string   // line text without the line ending
+	Section []string // section the line belongs to, nil before the first section
+	Header  bool     // the line is a section header
+	Key     string   // key as written in the file, empty for blank or comment lines
+	Value   string   // value with quotes and comment removed
+	Quote   byte     // quote character around the value, 0 if bare
+	Warning string   // why the line is ignored, empty if it is not
+}
+
+// configDoc is a parsed config file
+type configDoc struct {
+	Name  string
+	Lines []*configLine
+	CRLF  bool // lines end with \r\n
+}
+
+// Bytes returns the file contents with the original line endings
+func (doc *configDoc) Bytes() []byte {
+	eol := "\n"
+	if doc.CRLF {
+		eol = "\r\n"
+	}
+	lines := make([]string, len(doc.Lines))
+	for i, l := range doc.Lines {
+		lines[i] = l.Raw
+	}
+	return []byte(strings.Join(lines, eol))
+}
+
+// parseConfigDoc parses the config file contents. every malformed line is
+// reported in the returned error with its line number.
+func parseConfigDoc(name string, file []byte) (*configDoc, error) {
+
+	file = bytes.TrimPrefix(file, []byte("\xef\xbb\xbf"))
+	doc := &configDoc{Name: name, CRLF: bytes.Contains(file, []byte("\r\n"))}
+	var errs []error
+	var section []string
+
+	for i, raw := range strings.Split(string(file), "\n") {
+		line := &configLine{Num: i + 1, Raw: strings.TrimSuffix(raw, "\r"), Section: section}
+		doc.Lines = append(doc.Lines, line)
+
+		if err := line.parse(); err != "" {
+			errs = append(errs, &configError{File: name, Line: line.Num, Msg: err})
+		}
+		if line.Header {
+			section = line.Section
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return doc, nil
+}
+
+// parse splits the line into key and value. returns a description of the
+// problem if the line is malformed.
+func (l *configLine) parse() string {
+
+	text := strings.TrimSpace(l.Raw)
+	if text == "" || text[0] == '#' {
+		return ""
+	}
+
+	if text[0] == '[' {
+		section, err := parseSection(text)
+		if err != "" {
+			return err
+		}
+		l.Section = section
+		l.Header = true
+		return ""
+	}
+
+	k, v, ok := strings.Cut(text, "=")
+	if !ok {
+		l.Warning = fmt.Sprintf("ignored, expected `Key = Value`, found %q", text)
+		return ""
+	}
+
+	key := strings.TrimSpace(k)
+	if !isConfigKey(key) {
+		l.Warning = fmt.Sprintf("ignored, invalid key %q", key)
+		return ""
+	}
+
+	value, quote, err := parseConfigValue(strings.TrimSpace(v))
+	if err != "" {
+		return fmt.Sprintf("%s: %s", key, err)
+	}
+
+	l.Key = key
+	l.Value = value
+	l.Quote = quote
+	return ""
+}
+
+// setValue replaces the value of a key line, keeping the key and any
+// comment. the value must already be quoted if needed.
+func (l *configLine) setValue(value string) {
+
+	eq := strings.IndexByte(l.Raw, '=')
+	rest := strings.TrimLeft(l.Raw[eq+1:], " \t")
+	if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+		rest = rest[strings.IndexByte(rest[1:], rest[0])+2:]
+	}
+
+	comment := ""
+	if i := strings.IndexByte(rest, '#'); i >= 0 {
+		comment = "  " + rest[i:]
+	}
+	l.Raw = l.Raw[:eq+1] + " " + value + comment
+	l.parse()
+}
+
+// renameKey replaces the key of a key line
+func (l *configLine) renameKey(key string) {
+	i := strings.Index(l.Raw, l.Key)
+	l.Raw = l.Raw[:i] + key + l.Raw[i+len(l.Key):]
+	l.Key = key
+}
+
+// insert adds new lines before line index i
+func (doc *configDoc) insert(i int, raw ...string) {
+	lines := make([]*configLine, len(raw))
+	for j, r := range raw {
+		lines[j] = &configLine{Raw: r}
+		lines[j].parse()
+	}
+	doc.Lines = append(doc.Lines[:i], append(lines, doc.Lines[i:]...)...)
+}
+
+// parseConfigValue removes the quotes and trailing comment from a value
+func parseConfigValue(s string) (string, byte, string) {
+
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		v, _, _ := strings.Cut(s, "#")
+		return strings.TrimSpace(v), 0, ""
+	}
+
+	quote := s[0]
+	end := strings.IndexByte(s[1:], quote)
+	if end < 0 {
+		return "", 0, fmt.Sprintf("missing closing %c", quote)
+	}
+
+	rest := strings.TrimSpace(s[end+2:])
+	if rest != "" && rest[0] != '#' {
+		return "", 0, fmt.Sprintf("unexpected %q after quoted value", rest)
+	}
+	return s[1 : end+1], quote, ""
+}
+
+// parseSection splits a `[job."name"]` header into its dotted parts.
+// parts may be quoted to include spaces or dots.
+func parseSection(text string) ([]string, string) {
+
+	end := strings.LastIndexByte(text, ']')
+	if end < 0 {
+		return nil, fmt.Sprintf("missing closing ] in %q", text)
+	}
+	if rest := strings.TrimSpace(text[end+1:]); rest != "" && rest[0] != '#' {
+		return nil, fmt.Sprintf("unexpected %q after section", rest)
+	}
+
+	var parts []string
+	s := strings.TrimSpace(text[1:end])
+	for {
+		var part string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			q := strings.IndexByte(s[1:], s[0])
+			if q < 0 {
+				return nil, fmt.Sprintf("missing closing %c in section %q", s[0], text)
+			}
+			part, s = s[1:q+1], strings.TrimSpace(s[q+2:])
+		} else {
+			n := strings.IndexByte(s, '.')
+			if n < 0 {
+				n = len(s)
+			}
+			part, s = strings.TrimSpace(s[:n]), s[n:]
+			if !isConfigKey(part) {
+				return nil, fmt.Sprintf("invalid section %q", text)
+			}
+		}
+		parts = append(parts, part)
+
+		if s == "" {
+			return parts, ""
+		}
+		if s[0] != '.' {
+			return nil, fmt.Sprintf("invalid section %q", text)
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+func isConfigKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_' || r == '-' || r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfigDoc(t *testing.T) {
+
+	file := strings.Join([]string{
+		`# comment`,
+		`ESBackupPath = "C:\ProgramData\db_backup"   # quoted values are literal`,
+		`FtpPass      = 'pa"ss=word'`,
+		`FtpUri       = ftp://host/path?a=b # bare value`,
+		`a stray note`,
+		`[job."es 6.0"]`,
+		`BackupFolder = D:\backups`,
+	}, "\r\n")
+
+	doc, err := parseConfigDoc("test.config", []byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.CRLF {
+		t.Error("CRLF not detected")
+	}
+
+	tests := []struct {
+		line    int
+		key     string
+		value   string
+		section []string
+	}{
+		{2, "ESBackupPath", `C:\ProgramData\db_backup`, nil},
+		{3, "FtpPass", `pa"ss=word`, nil},
+		{4, "FtpUri", "ftp://host/path?a=b", nil},
+		{7, "BackupFolder", `D:\backups`, []string{"job", "es 6.0"}},
+	}
+	for _, tt := range tests {
+		l := doc.Lines[tt.line-1]
+		if l.Key != tt.key || l.Value != tt.value {
+			t.Errorf("line %d: got %s = %q, want %s = %q", tt.line, l.Key, l.Value, tt.key, tt.value)
+		}
+		if strings.Join(l.Section, ".") != strings.Join(tt.section, ".") {
+			t.Errorf("line %d: section %q, want %q", tt.line, l.Section, tt.section)
+		}
+	}
+
+	if w := doc.Lines[4].Warning; w == "" {
+		t.Error("line 5: no warning for a line that is not Key = Value")
+	}
+	if got := string(doc.Bytes()); got != file {
+		t.Errorf("Bytes() changed the file:\n%s", got)
+	}
+}
+
+func TestParseConfigDocErrors(t *testing.T) {
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"Archive = true\nFtpPass = \"secret\n", `test.config:2: FtpPass: missing closing "`},
+		{"FtpPass = 'a' b\n", `test.config:1: FtpPass: unexpected "b" after quoted value`},
+		{"[job.a\n", "test.config:1: missing closing ]"},
+		{"[job.a b]\n", "test.config:1: invalid section"},
+	}
+	for _, tt := range tests {
+		_, err := parseConfigDoc("test.config", []byte(tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %v, want %q", tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+
+	doc, err := parseConfigDoc("test.config", []byte(`FtpPass = "old"  # the password`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Lines[0].setValue(`"new=value"`)
+	if got, want := doc.Lines[0].Raw, `FtpPass = "new=value"  # the password`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if doc.Lines[0].Value != "new=value" {
+		t.Errorf("value %q, want %q", doc.Lines[0].Value, "new=value")
+	}
+}
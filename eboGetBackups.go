@@ -16,6 +16,7 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -32,6 +33,8 @@ var configName = changeExt(exeName, ".config")
 var defaultConfigFile = filepath.Join(exeDir, configName)
 
 var logFile string
+var listExplain bool
+var selectedJob string
 
 // visitLatestBackupFiles returns a WalkFunc to build a file list with the
 // latest backup file from each directory
@@ -42,7 +45,7 @@ func visitLatestBackupFiles(files *[]string) filepath.WalkFunc {
 	return func(path string, info os.FileInfo, err error) error {
 
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		if IsFileXBK(path) {
@@ -77,6 +80,10 @@ func getConfigFile() (string, error) {
 		return configName, ErrMissingConfigFile
 	}
 
+	if isRemoteConfig(configName) {
+		return configName, nil
+	}
+
 	if _, err := os.Stat(configName); err == nil {
 		return configName, nil
 	}
@@ -109,40 +116,22 @@ func filter(xs []string, predicate StringPredicate) []string {
 	return xs[:count]
 }
 
-func readDirNames(path string) []string {
+func readDirNames(path string) ([]string, error) {
 	dir, err := os.Open(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer dir.Close()
-	names, err := dir.Readdirnames(-1)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return names
+	return dir.Readdirnames(-1)
 }
 
-func readDir(path string) []fs.FileInfo {
+func readDir(path string) ([]fs.FileInfo, error) {
 	dir, err := os.Open(path)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer dir.Close()
-	fis, err := dir.Readdir(-1)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return fis
-}
-
-// fileExists tests if exists in list
-func fileExists(n string, ns []string) bool {
-	for _, f := range ns {
-		if filepath.Base(n) == filepath.Base(f) {
-			return true
-		}
-	}
-	return false
+	return dir.Readdir(-1)
 }
 
 func openLog() io.Closer {
@@ -176,8 +165,17 @@ var root = &cobra.Command{
 		}
 
 		err := backupAndArchive()
-		if err != nil {
+		switch {
+		case err == nil:
+		case err == ErrJobsFailed:
+			os.Exit(1)
+		case err == ErrStaleBackups:
+			os.Exit(3)
+		case err == ErrMissingConfigFile:
 			cmd.Usage()
+			os.Exit(2)
+		default:
+			os.Exit(2)
 		}
 	},
 }
@@ -185,8 +183,16 @@ var root = &cobra.Command{
 var findCmd = &cobra.Command{
 	Use:   "find",
 	Short: "list the ebo servers backup locations",
+	Long: `List the ebo servers backup locations.
+
+	for each server the version, service key, install, db and backup
+	paths are shown with the number of backups and when the newest was
+	written. servers that cannot be read are listed with the error.
+	`,
 	Run: func(cmd *cobra.Command, args []string) {
-		listLocations()
+		if err := listLocations(); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
@@ -208,10 +214,32 @@ var listCmd = &cobra.Command{
 			cmd.Usage()
 			return
 		}
-		config := loadConfig(file)
-		files := config.getBackupFiles()
-		for _, file := range files {
-			fmt.Println(file)
+		jobs, err := loadConfig(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, config := range jobs {
+			if len(jobs) > 1 {
+				fmt.Printf("[job.%s]\n", config.Name)
+			}
+			if listExplain {
+				if err := config.explainBackups(); err != nil {
+					log.Printf("Error listing backups: %v\n", err)
+				}
+				config.printArtifacts()
+				config.printStale()
+				continue
+			}
+			files, err := config.getBackupFiles()
+			if err != nil {
+				log.Printf("Error listing backups: %v\n", err)
+				continue
+			}
+			for _, file := range files {
+				fmt.Println(file)
+			}
+			config.printArtifacts()
+			config.printStale()
 		}
 	},
 }
@@ -219,6 +247,12 @@ var listCmd = &cobra.Command{
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "create an initial backup configuration file",
+	Long: `Create an initial backup configuration file.
+
+	the ES backup path is taken from the last server found, or the one
+	named with --server. any setting can be given with its flag, or
+	answered at the prompts with --interactive.
+	`,
 	Run: func(cmd *cobra.Command, args []string) {
 		file, err := getConfigFile()
 		if err != ErrMissingConfigFile {
@@ -226,19 +260,48 @@ var initCmd = &cobra.Command{
 			cmd.Usage()
 			return
 		}
-		initializeConfig()
+		if err := initializeConfig(file); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "check and manage the configuration file",
+}
+
 func main() {
 
 	root.AddCommand(findCmd)
 	root.AddCommand(versionCmd)
 	root.AddCommand(listCmd)
 	root.AddCommand(initCmd)
+	root.AddCommand(configCmd)
+	root.AddCommand(secretCmd)
+
+	configCmd.AddCommand(validateCmd)
+	configCmd.AddCommand(migrateCmd)
+	configCmd.AddCommand(showCmd)
+	secretCmd.AddCommand(secretSetCmd)
+
+	initCmd.Flags().StringVar(&initServer, "server", "", "name of the discovered server to back up")
+	initCmd.Flags().BoolVarP(&initInteractive, "interactive", "i", false, "prompt for the server and each setting")
+	listCmd.Flags().BoolVar(&listExplain, "explain", false, "list every backup found with why it is or is not collected")
+	findCmd.Flags().BoolVar(&findJSON, "json", false, "print the servers as json")
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "report the changes without saving them")
+	showCmd.Flags().BoolVar(&showEffective, "effective", false, "print the resolved settings and their sources")
+	showCmd.Flags().BoolVar(&showJSON, "json", false, "print the resolved settings as json")
+	secretSetCmd.Flags().BoolVar(&secretPrint, "print", false, "print the encrypted value instead of saving it")
 
 	root.Flags().StringVar(&logFile, "log", "", "optional log file")
-	root.Flags().StringVar(&configName, "config", configName, "configuration file")
+	root.PersistentFlags().StringVar(&configName, "config", configName, "configuration file")
+	root.PersistentFlags().StringVar(&selectedJob, "job", "", "run only the named job")
+	root.PersistentFlags().StringVar(&inventoryFile, "inventory", inventoryFile, "read the servers from a json inventory or .reg file instead of the registry")
+	root.PersistentFlags().StringVar(&discoveryMode, "discovery", discoveryMode, "how servers are found: auto, registry, fs or inventory")
+	root.PersistentFlags().StringVar(&discoveryRoot, "discovery-root", discoveryRoot, "folder to search for servers, e.g. a mounted disk")
+	root.PersistentFlags().StringVar(&configKey, "config-key", configKey, "public key of signed https config files, base64 or a file")
+	addSettingFlags(root)
 
 	if err := root.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -246,10 +309,19 @@ func main() {
 	}
 }
 
-func backupAndArchive() error {
+// ErrJobsFailed is returned when one or more backup jobs did not complete
+var ErrJobsFailed = errors.New("backup jobs failed")
+
+// backupAndArchive runs every job. the run exits with status 1 when a job
+// failed, 2 when the config could not be read and 3 for stale backups.
+func backupAndArchive() (err error) {
 
 	log.Printf("starting backup\n")
 	defer func() {
+		if err != nil && err != ErrJobsFailed && err != ErrStaleBackups {
+			log.Printf("backup not started\n")
+			return
+		}
 		log.Printf("backup completed\n")
 	}()
 
@@ -258,20 +330,88 @@ func backupAndArchive() error {
 		log.Printf("Error config file '%s' not found!\n", file)
 		return err
 	}
-	config := loadConfig(file)
+	jobs, err := loadConfig(file)
+	if err != nil {
+		log.Printf("Error reading config file: %v\n", err)
+		return err
+	}
+
+	// run every job, a failed job does not stop the others
+	results := make([]error, len(jobs))
+	for i, config := range jobs {
+		if len(jobs) > 1 {
+			log.Printf("starting job `%s`\n", config.Name)
+		}
+		results[i] = config.run()
+	}
+
+	failed, stale := 0, 0
+	for i, config := range jobs {
+		for _, s := range config.stale {
+			stale++
+			log.Printf("job `%s`: %s\n", config.jobName(), s)
+		}
+		if results[i] != nil {
+			failed++
+			log.Printf("job `%s` failed: %v\n", config.jobName(), results[i])
+			continue
+		}
+		log.Printf("job `%s` ok\n", config.jobName())
+	}
+	switch {
+	case failed > 0:
+		return ErrJobsFailed
+	case stale > 0:
+		return ErrStaleBackups
+	}
+	return nil
+}
+
+// run collects, archives and uploads the backups of a job
+func (config *configSettings) run() error {
 
 	log.Printf("checking backups in %s\n", config.ESBackupPath)
-	files := config.getBackupFiles()
+	files, err := config.getBackupFiles()
+	if err != nil {
+		return err
+	}
 	log.Printf("found %d backups\n", len(files))
+	files = config.uniqueBackups(files)
+	if err := config.checkArtifactsFolder(files); err != nil {
+		return err
+	}
 
-	config.collectBackups(files)
+	err = config.checkStale()
+	if err != nil {
+		return err
+	}
+
+	err = config.collectBackups(files)
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := config.getArtifacts()
+	if err != nil {
+		return err
+	}
+	if config.Artifacts != "" {
+		log.Printf("found %d artifacts\n", len(artifacts))
+	}
+	err = config.collectArtifacts(artifacts)
+	if err != nil {
+		return err
+	}
 
 	if !config.Archive {
 		return nil
 	}
 
 	log.Printf("starting archive\n")
-	archiveName := config.archiveBackups(files)
+	archiveName, err := config.archiveBackups(files, artifacts)
+	if err != nil {
+		return err
+	}
 	log.Printf("archive complete\n")
 
 	if !config.Ftp {
@@ -284,76 +424,180 @@ func backupAndArchive() error {
 	}
 
 	log.Printf("uploading archive to ftp\n")
-	config.uploadArchive(archiveName)
-	return nil
+	return config.uploadArchive(archiveName)
 }
 
 // getBackupFiles gets the latest set of backup files from the backup path
-func (config *configSettings) getBackupFiles() []string {
+func (config *configSettings) getBackupFiles() ([]string, error) {
+	if p, err := config.policy(nil); err != nil || len(config.servers) > 0 || !p.isDefault() {
+		return config.getSelectedBackupFiles()
+	}
 	files := []string{}
 	err := filepath.Walk(config.ESBackupPath, visitLatestBackupFiles(&files))
-	if err != nil {
-		log.Fatal(err)
-	}
-	return files
+	return files, err
 }
 
-// collectBackups reads all sub folders
-func (config *configSettings) collectBackups(files []string) {
+// collectBackups copies the backups to BackupFolder. the backups must
+// have different targets, see uniqueBackups.
+func (config *configSettings) collectBackups(files []string) error {
 
 	err := os.MkdirAll(filepath.FromSlash(config.BackupFolder), fs.ModePerm|fs.ModeDir)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	// the backups are matched by their path in BackupFolder, the file name
+	// or, with PreserveStructure, server/name
+	var targets []string
+	sources := map[string]string{}
+	for _, file := range files {
+		target := config.backupTarget(file)
+		sources[target] = file
+		targets = append(targets, target)
 	}
 
 	// delete old .xbk backup files.
 	// keeping current files so we don't need to copy again
-	// comparison is by name only
-	names := readDirNames(config.BackupFolder)
-	names = filter(names, IsFileXBK)
-	for _, file := range names {
-		if !fileExists(file, files) {
-			log.Printf("deleting old backup `%s` from %s\n", file, config.BackupFolder)
-			err := os.Remove(filepath.Join(config.BackupFolder, file))
-			if err != nil {
-				log.Printf("error deleting backup: %v", err)
-			}
+	collected, err := config.collectedBackups()
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, target := range collected {
+		if _, ok := sources[target]; ok {
+			existing[target] = true
+			continue
+		}
+		log.Printf("deleting old backup `%s` from %s\n", target, config.BackupFolder)
+		if err := os.Remove(filepath.Join(config.BackupFolder, filepath.FromSlash(target))); err != nil {
+			log.Printf("error deleting backup: %v", err)
+			continue
+		}
+		config.removeEmptyFolders(path.Dir(target))
+	}
+
+	for _, target := range targets {
+		if existing[target] {
+			continue
+		}
+		file := sources[target]
+		log.Printf("copying `%s`\n", target)
+		dir := filepath.Join(config.BackupFolder, filepath.FromSlash(path.Dir(target)))
+		if err := os.MkdirAll(dir, fs.ModePerm|fs.ModeDir); err != nil {
+			return err
+		}
+		newFile, err := copyFileTo(file, dir)
+		if err != nil {
+			return err
+		}
+
+		if err := validateFile(newFile); err != nil {
+			os.Remove(newFile)
+			return err
 		}
 	}
+	return nil
+}
 
+// uniqueBackups drops the backups collected under the same name as one
+// before them, so BackupFolder and the archive hold the same backups
+func (config *configSettings) uniqueBackups(files []string) []string {
+
+	var unique []string
+	sources := map[string]string{}
 	for _, file := range files {
-		if fileExists(file, names) {
+		target := config.backupTarget(file)
+		if other, ok := sources[target]; ok {
+			log.Printf("warning: `%s` and `%s` are both collected as `%s`, set PreserveStructure to keep both\n", other, file, target)
 			continue
 		}
-		log.Printf("copying `%s`\n", filepath.Base(file))
-		newFile, err := copyFileTo(file, config.BackupFolder)
+		sources[target] = file
+		unique = append(unique, file)
+	}
+	return unique
+}
+
+// backupTarget returns the path of a backup in BackupFolder and in the
+// archive: its name, or its path in ESBackupPath with PreserveStructure
+func (config *configSettings) backupTarget(file string) string {
+	if config.PreserveStructure {
+		rel, err := filepath.Rel(config.ESBackupPath, file)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(file)
+}
+
+// collectedBackups returns the paths of the backups in BackupFolder. the
+// server folders are searched even without PreserveStructure, so backups
+// collected before it was turned off are removed.
+func (config *configSettings) collectedBackups() ([]string, error) {
+
+	var targets []string
+	err := filepath.WalkDir(config.BackupFolder, func(file string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return
+			return err
 		}
+		if !d.IsDir() && IsFileXBK(file) {
+			rel, err := filepath.Rel(config.BackupFolder, file)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return targets, err
+}
 
-		validateFile(newFile)
+// removeEmptyFolders removes the folder of BackupFolder and its parents
+// when they are empty
+func (config *configSettings) removeEmptyFolders(dir string) {
+	for ; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if os.Remove(filepath.Join(config.BackupFolder, filepath.FromSlash(dir))) != nil {
+			return
+		}
 	}
 }
 
-// archiveBackups creates a new archive file with the current backups
-func (config *configSettings) archiveBackups(files []string) string {
+// archiveBackups creates a new archive file with the current backups and
+// the artifacts in their own folder
+func (config *configSettings) archiveBackups(files []string, artifacts []artifact) (string, error) {
 
 	if config.ArchiveFolder == "" {
-		log.Fatal("error, no archive folder.")
+		return "", errors.New("error, no archive folder.")
 	}
 
 	err := os.MkdirAll(config.ArchiveFolder, fs.ModePerm|fs.ModeDir)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 
-	fileName := config.getZipFile()
+	fileName, err := config.getZipFile()
+	if err != nil {
+		return "", err
+	}
 	log.Printf("creating archive `%s`\n", fileName)
-	ZipFiles(fileName, files)
+	all := append([]string{}, files...)
+	entries := map[string]string{}
+	for _, a := range artifacts {
+		all = append(all, a.Path)
+		entries[a.Path] = artifactsFolder + "/" + a.Name
+	}
+	err = ZipFilesAs(fileName, all, func(file string) string {
+		if name, ok := entries[file]; ok {
+			return name
+		}
+		return config.archiveEntry(file)
+	})
+	if err != nil {
+		return "", err
+	}
 
 	config.archiveRemoveOld()
 
-	return fileName
+	return fileName, nil
 }
 
 // archiveRemoveOld removes old archives
@@ -361,14 +605,15 @@ func (config *configSettings) archiveRemoveOld() {
 
 	log.Printf("removing old archives")
 
-	if config.ArchiveFolder == "" {
-		log.Fatal("error, no archive folder.")
-	}
 	if config.ArchiveCount < 1 {
 		return
 	}
 
-	fis := readDir(config.ArchiveFolder)
+	fis, err := readDir(config.ArchiveFolder)
+	if err != nil {
+		log.Printf("error [%v] reading archives\n", err)
+		return
+	}
 	if len(fis) <= config.ArchiveCount {
 		return
 	}
@@ -386,74 +631,35 @@ func (config *configSettings) archiveRemoveOld() {
 }
 
 // getZipFile generates a zip-file name from config and the current date
-func (config *configSettings) getZipFile() string {
-
-	currentTime := time.Now()
-
-	zipFile := config.ArchiveName
-	zipExt := filepath.Ext(zipFile)
+func (config *configSettings) getZipFile() (string, error) {
 
+	_, zipExt := splitExt(config.ArchiveName)
 	if zipExt == "" {
 		zipExt = ".zip"
-	} else {
-		zipFile = strings.TrimSuffix(zipFile, zipExt)
-	}
-
-	if config.ArchiveISOWeek {
-		isoYear, isoWeek := currentTime.ISOWeek()
-		zipFile = fmt.Sprintf("%s_%04dW%02d%s", zipFile, isoYear, isoWeek, zipExt)
-		return filepath.Join(config.ArchiveFolder, zipFile)
 	}
 
-	if config.ArchiveWeekday {
-		weekday := currentTime.Weekday().String()
-		zipFile = fmt.Sprintf("%s_%s%s", zipFile, weekday, zipExt)
-		return filepath.Join(config.ArchiveFolder, zipFile)
-	}
-
-	if config.ArchiveAddYear {
-		currentYear := currentTime.Year()
-		zipFile = fmt.Sprintf("%s_%04d", zipFile, currentYear)
-	}
-	if config.ArchiveAddMonth {
-		currentMonth := currentTime.Month()
-		zipFile = fmt.Sprintf("%s_%02d", zipFile, currentMonth)
+	zipFile, err := expandTemplate(config.archiveTemplate(), config.nameToken(time.Now()))
+	if err != nil {
+		return "", fmt.Errorf("ArchiveName: %v", err)
 	}
-	zipFile = fmt.Sprintf("%s%s", zipFile, zipExt)
 
-	return filepath.Join(config.ArchiveFolder, zipFile)
+	return filepath.Join(config.ArchiveFolder, zipFile+zipExt), nil
 }
 
 // getFtpFile generates a ftp-file name from config and the current date
-func (config *configSettings) getFtpFile(archive string) string {
-
-	currentTime := time.Now()
+func (config *configSettings) getFtpFile(archive string) (string, error) {
 
 	fileExt := filepath.Ext(archive)
-
-	ftpFile := config.FtpName
-	if ftpFile == "" {
-		ftpFile = config.ArchiveName
-	}
-
 	if fileExt == "" {
 		fileExt = ".zip"
-	} else {
-		ftpFile = strings.TrimSuffix(ftpFile, fileExt)
-	}
-
-	if config.FtpAddYear {
-		currentYear := currentTime.Year()
-		ftpFile = fmt.Sprintf("%s_%04d", ftpFile, currentYear)
 	}
-	if config.FtpAddMonth {
-		currentMonth := currentTime.Month()
-		ftpFile = fmt.Sprintf("%s_%02d", ftpFile, currentMonth)
 
+	ftpFile, err := expandTemplate(config.ftpTemplate(fileExt), config.nameToken(time.Now()))
+	if err != nil {
+		return "", fmt.Errorf("FtpName: %v", err)
 	}
 
-	ftpFile = fmt.Sprintf("%s%s", ftpFile, fileExt)
-	return ftpFile
+	return ftpFile + fileExt, nil
 }
 
 // isFtpScheduled checks if ftp is scheduled
@@ -464,9 +670,9 @@ func (config *configSettings) isFtpScheduled() bool {
 	}
 
 	currentTime := time.Now()
-	weekday := strings.ToLower(currentTime.Weekday().String())
+	weekday := currentTime.Weekday().String()
 
-	return config.FtpWeekday == weekday
+	return strings.EqualFold(strings.TrimSpace(config.FtpWeekday), weekday)
 }
 
 func Usage() {
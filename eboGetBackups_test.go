@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUniqueBackups(t *testing.T) {
+
+	files := []string{
+		filepath.Join("db", "ES-A", "nightly.xbk"),
+		filepath.Join("db", "ES-B", "nightly.xbk"),
+		filepath.Join("db", "ES-B", "weekly.xbk"),
+	}
+
+	flat := configSettings{ESBackupPath: "db"}
+	if got, want := flat.uniqueBackups(files), []string{files[0], files[2]}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	preserve := configSettings{ESBackupPath: "db", PreserveStructure: true}
+	if got := preserve.uniqueBackups(files); !slices.Equal(got, files) {
+		t.Errorf("PreserveStructure: got %q, want every backup", got)
+	}
+}
+
+func TestCheckArtifactsFolder(t *testing.T) {
+
+	files := []string{filepath.Join("db", "Artifacts", "nightly.xbk")}
+
+	tests := []struct {
+		config configSettings
+		clash  bool
+	}{
+		{configSettings{ESBackupPath: "db", PreserveStructure: true}, false},
+		{configSettings{ESBackupPath: "db", Artifacts: "install:etc/*"}, false},
+		{configSettings{ESBackupPath: "db", Artifacts: "install:etc/*", PreserveStructure: true}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.checkArtifactsFolder(files); (err != nil) != tt.clash {
+			t.Errorf("Artifacts %q, PreserveStructure %v: got error %v", tt.config.Artifacts, tt.config.PreserveStructure, err)
+		}
+	}
+}
+
+func TestFtpWeekday(t *testing.T) {
+
+	today := time.Now().Weekday()
+	tests := []struct {
+		day  string
+		want bool
+	}{
+		{"", true},
+		{strings.ToLower(today.String()), true},
+		{strings.ToUpper(today.String()), true},
+		{" " + today.String() + " ", true},
+		{((today + 1) % 7).String(), false},
+	}
+	for _, tt := range tests {
+		config := configSettings{FtpWeekday: tt.day}
+		if got := config.isFtpScheduled(); got != tt.want {
+			t.Errorf("%q on a %s: got %v, want %v", tt.day, today, got, tt.want)
+		}
+	}
+}
@@ -1,16 +1,10 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
-	"os"
-	"path"
 	"path/filepath"
 	"strings"
-
-	"golang.org/x/sys/windows/registry"
 )
 
 // Computer\HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Services\Building Operation 2.0 Enterprise Server
@@ -28,78 +22,131 @@ type eboService struct {
 	key   string
 	name  string
 	image string
+	kind  serverKind
+	db    string // db folder when it is not read from the install folder
 }
 
-func listLocations() {
+// serverKind is the kind of an EBO server
+type serverKind string
 
-	ess, err := EnterpriseServers()
-	if err != nil {
-		return
+const (
+	kindEnterpriseServer  serverKind = "es"
+	kindEnterpriseCentral serverKind = "ec"
+)
+
+// serverKinds are the kinds of servers found, with the end of their
+// service names
+var serverKinds = []struct {
+	kind   serverKind
+	suffix string
+}{
+	{kindEnterpriseServer, "Enterprise Server"},
+	{kindEnterpriseCentral, "Enterprise Central"},
+}
+
+// serviceKind returns the kind of server of a service, or an empty kind
+// for other services
+func serviceKind(service string) serverKind {
+	for _, k := range serverKinds {
+		if strings.HasSuffix(service, k.suffix) {
+			return k.kind
+		}
+	}
+	return ""
+}
+
+// title returns the name of the kind, e.g. Enterprise Central
+func (k serverKind) title() string {
+	for _, sk := range serverKinds {
+		if sk.kind == k {
+			return sk.suffix
+		}
 	}
+	return string(k)
+}
 
-	for _, es := range ess {
-		dbPath, _ := es.DBBackupPath()
-		fmt.Println(es.name, ":", dbPath)
+// parseServerKind returns the kind named by its short name, es or ec
+func parseServerKind(s string) (serverKind, error) {
+	for _, k := range serverKinds {
+		if strings.EqualFold(s, string(k.kind)) {
+			return k.kind, nil
+		}
 	}
+	return "", fmt.Errorf("%q is not a server kind, use es or ec", s)
 }
 
+// EnterpriseServers returns the Enterprise Server services found by the
+// server locator. services that cannot be read are skipped.
 func EnterpriseServers() ([]*eboService, error) {
+	return serversOfKind(kindEnterpriseServer)
+}
 
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE, key_system_services, registry.ENUMERATE_SUB_KEYS)
-	if err != nil {
-		return nil, err
-	}
-	defer k.Close()
+// Servers returns the servers of every kind found by the server locator.
+// services that cannot be read are skipped.
+func Servers() ([]*eboService, error) {
+	return serversOfKind("")
+}
+
+// serversOfKind returns the servers of the kind, or of every kind for an
+// empty kind
+func serversOfKind(kind serverKind) ([]*eboService, error) {
 
-	services, err := k.ReadSubKeyNames(0)
+	found, err := findServices()
 	if err != nil {
 		return nil, err
 	}
 
 	eboServices := make([]*eboService, 0)
-	n := 0
-	for i := range services {
-		if strings.HasSuffix(services[i], "Enterprise Server") {
-			key := fmt.Sprintf(`%s\%s`, key_system_services, services[i])
-			s, err := readService(key)
-			if err != nil {
-				continue
-			}
-			eboServices = append(eboServices, s)
-			n++
+	for _, f := range found {
+		if f.err == nil && (kind == "" || f.kind == kind) {
+			eboServices = append(eboServices, f.service)
 		}
 	}
 	return eboServices, nil
 }
 
-func readService(key string) (*eboService, error) {
+// foundService is a service found by the locator, or the error reading it
+type foundService struct {
+	key     string
+	kind    serverKind
+	service *eboService
+	err     error
+}
 
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE, key, registry.QUERY_VALUE)
-	if err != nil {
-		return nil, err
-	}
-	defer k.Close()
+// findServices returns every Enterprise Server and Enterprise Central
+// service of the server locator
+func findServices() ([]foundService, error) {
 
-	displayName, _, err := k.GetStringValue("DisplayName")
+	locator, err := serverLocator()
 	if err != nil {
 		return nil, err
 	}
 
-	imagePath, _, err := k.GetStringValue("ImagePath")
+	services, err := locator.ServiceKeys()
 	if err != nil {
 		return nil, err
 	}
 
-	eboService1 := &eboService{
-		key:   key,
-		name:  displayName,
-		image: trimQuote(imagePath),
+	var found []foundService
+	for i := range services {
+		kind := serviceKind(services[i])
+		if kind == "" {
+			continue
+		}
+		key := fmt.Sprintf(`%s\%s`, key_system_services, services[i])
+		s, err := locator.ReadService(key)
+		if err == nil {
+			s.kind = kind
+		}
+		found = append(found, foundService{key, kind, s, err})
 	}
-
-	return eboService1, nil
+	return found, nil
 }
 
 func trimQuote(s string) string {
+	if s == "" {
+		return s
+	}
 	if s[0] == '"' {
 		s = s[1:]
 	}
@@ -111,57 +158,52 @@ func trimQuote(s string) string {
 
 func readImagePath(key string) (string, error) {
 
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE, key, registry.QUERY_VALUE)
+	locator, err := serverLocator()
 	if err != nil {
 		return "", err
 	}
-	defer k.Close()
-
-	s, _, err := k.GetStringValue("ImagePath")
+	s, err := locator.ReadService(key)
 	if err != nil {
 		return "", err
 	}
-
-	return trimQuote(s), nil
+	return s.image, nil
 }
 
 var ErrNotFound = errors.New("path to DB folder not found")
 
+// ErrNoInstall is returned for a server found by its data folder only
+var ErrNoInstall = errors.New("install folder not found")
+
 func readBackupPath(installPath string) (string, error) {
 	db, err := readDBPath(installPath)
 	if err != nil {
 		return "", err
 	}
-	return path.Join(path.Dir(db), es_backup_folder), nil
+	return filepath.Join(filepath.Dir(db), es_backup_folder), nil
 }
 
+// readDBPath returns the db folder of the server installed in the folder,
+// server.paths.db in etc\dbpath.properties
 func readDBPath(installPath string) (string, error) {
 
 	// C:\Program Files (x86)\Schneider Electric EcoStruxure\Building Operation 2.0\Enterprise Server\etc\dbpath.properties
 	// server.paths.db=C:/ProgramData/Schneider Electric EcoStruxure/Building Operation 2.0/Enterprise Server/db
 
-	pf := filepath.Join(installPath, `etc\dbpath.properties`)
-	f, err := os.ReadFile(pf)
+	props, err := readDBProperties(installPath)
 	if err != nil {
-		// fmt.Println(err)
 		return "", err
 	}
-
-	s := bufio.NewScanner(bytes.NewReader(f))
-	for s.Scan() {
-		kv := strings.Split(s.Text(), "=")
-		if len(kv) != 2 {
-			continue
-		}
-		k := strings.ToLower(strings.TrimSpace(kv[0]))
-		if k != "server.paths.db" {
-
-			continue
-		}
-		v := strings.TrimSpace(kv[1])
-		return filepath.Dir(trimQuote(v)), nil
+	db := trimQuote(strings.TrimSpace(props["server.paths.db"]))
+	if db == "" {
+		return "", ErrNotFound
 	}
-	return "", ErrNotFound
+	return filepath.Clean(db), nil
+}
+
+// readDBProperties returns every key of etc\dbpath.properties of the
+// server installed in the folder
+func readDBProperties(installPath string) (map[string]string, error) {
+	return readProperties(filepath.Join(installPath, "etc", "dbpath.properties"))
 }
 
 func EnterpriseServersPaths(es_service_keys []string) []string {
@@ -207,6 +249,9 @@ func EnterpriseServerBackupPaths(paths []string) []string {
 }
 
 func (es *eboService) InstallPath() string {
+	if es.image == "" {
+		return ""
+	}
 	return filepath.Dir(filepath.Dir(es.image))
 }
 
@@ -215,28 +260,20 @@ func (es *eboService) DBBackupPath() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return path.Join(path.Dir(dbPath), es_backup_folder), nil
+	return filepath.Join(filepath.Dir(dbPath), es_backup_folder), nil
 }
 
 func (es *eboService) DBPath() (string, error) {
-	pf := filepath.Join(es.InstallPath(), `etc\dbpath.properties`)
-
-	f, err := os.ReadFile(pf)
-	if err != nil {
-		return "", err
+	if es.db != "" {
+		return es.db, nil
 	}
+	return readDBPath(es.InstallPath())
+}
 
-	s := bufio.NewScanner(bytes.NewReader(f))
-	for s.Scan() {
-		kv := strings.Split(s.Text(), "=")
-		if len(kv) != 2 {
-			continue
-		}
-		k := strings.ToLower(strings.TrimSpace(kv[0]))
-		if k != "server.paths.db" {
-			continue
-		}
-		return strings.TrimSpace(kv[1]), nil
+// Properties returns the settings in etc\dbpath.properties of the server
+func (es *eboService) Properties() (map[string]string, error) {
+	if es.image == "" {
+		return nil, ErrNoInstall
 	}
-	return "", ErrNotFound
+	return readDBProperties(es.InstallPath())
 }
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func defaultLocator() (ServerLocator, error) {
+	return nil, errors.New("the registry is only available on Windows")
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"golang.org/x/sys/windows/registry"
+)
+
+// registryLocator finds the services in the registry of this computer
+type registryLocator struct{}
+
+func defaultLocator() (ServerLocator, error) {
+	return registryLocator{}, nil
+}
+
+func (registryLocator) ServiceKeys() ([]string, error) {
+
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, key_system_services, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	return k.ReadSubKeyNames(0)
+}
+
+func (registryLocator) ReadService(key string) (*eboService, error) {
+
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, key, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	displayName, _, err := k.GetStringValue("DisplayName")
+	if err != nil {
+		return nil, err
+	}
+
+	imagePath, _, err := k.GetStringValue("ImagePath")
+	if err != nil {
+		return nil, err
+	}
+
+	eboService1 := &eboService{
+		key:   key,
+		name:  displayName,
+		image: trimQuote(imagePath),
+	}
+
+	return eboService1, nil
+}
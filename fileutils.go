@@ -1,8 +1,8 @@
 package main
 
 import (
+	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,14 +19,10 @@ func copyFileTo(sourceFile, destDir string) (string, error) {
 
 	err := copyFile(destFile, sourceFile)
 	if err != nil {
-		log.Fatal(err)
+		return destFile, err
 	}
 
 	err = copyInfo(destFile, sourceFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	return destFile, err
 }
 
@@ -66,6 +62,19 @@ func copyFile(dstName, srcName string) error {
 	return nil
 }
 
+// validateFile checks a copied backup can be read and is not empty
+func validateFile(name string) error {
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("backup `%s` is empty", name)
+	}
+	return nil
+}
+
 // remove the file extension from the path
 func removeExt(path string) string {
 	return strings.TrimSuffix(path, filepath.Ext(path))
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+var findJSON bool
+
+// serverInfo is what find reports about a server
+type serverInfo struct {
+	Name        string            `json:"name"`
+	Key         string            `json:"key"`
+	Kind        serverKind        `json:"kind"`
+	Version     string            `json:"version,omitempty"`
+	InstallPath string            `json:"installPath,omitempty"`
+	DBPath      string            `json:"dbPath,omitempty"`
+	BackupPath  string            `json:"backupPath,omitempty"`
+	Properties  map[string]string `json:"properties,omitempty"`
+	Backups     int               `json:"backups"`
+	Newest      *time.Time        `json:"newest,omitempty"`
+	Errors      []string          `json:"errors,omitempty"`
+}
+
+// listLocations prints the servers found with their paths and backups
+func listLocations() error {
+
+	found, err := findServices()
+	if err != nil {
+		return fmt.Errorf("server discovery failed: %v", err)
+	}
+
+	infos := make([]*serverInfo, 0, len(found))
+	for _, f := range found {
+		infos = append(infos, describeServer(f))
+	}
+
+	if findJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+	printServers(infos)
+	return nil
+}
+
+// describeServer collects the paths and backups of a server. each step
+// that fails is recorded and the rest are still tried.
+func describeServer(f foundService) *serverInfo {
+
+	info := &serverInfo{Key: f.key, Kind: f.kind}
+	if f.err != nil {
+		info.Errors = append(info.Errors, f.err.Error())
+		return info
+	}
+
+	es := f.service
+	info.Name = es.name
+	info.InstallPath = es.InstallPath()
+	info.Version = eboVersion(info.InstallPath)
+	if info.Version == "" {
+		info.Version = eboVersion(es.name)
+	}
+
+	var err error
+	info.Properties, err = es.Properties()
+	if err != nil && err != ErrNoInstall {
+		info.Errors = append(info.Errors, fmt.Sprintf("properties: %v", err))
+		return info
+	}
+	info.DBPath, err = es.DBPath()
+	if err != nil {
+		info.Errors = append(info.Errors, fmt.Sprintf("db path: %v", err))
+		return info
+	}
+	info.BackupPath, err = es.DBBackupPath()
+	if err != nil {
+		info.Errors = append(info.Errors, fmt.Sprintf("backup path: %v", err))
+		return info
+	}
+
+	err = filepath.WalkDir(info.BackupPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !IsFileXBK(path) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		info.Backups++
+		if t := fi.ModTime(); info.Newest == nil || t.After(*info.Newest) {
+			info.Newest = &t
+		}
+		return nil
+	})
+	if err != nil {
+		info.Errors = append(info.Errors, fmt.Sprintf("backups: %v", err))
+	}
+	return info
+}
+
+// printServers prints a table of the servers followed by their errors
+func printServers(infos []*serverInfo) {
+
+	if len(infos) == 0 {
+		fmt.Println("no enterprise servers or enterprise central found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tVERSION\tBACKUPS\tNEWEST\tKEY\tINSTALL PATH\tDB PATH\tBACKUP PATH")
+	for _, s := range infos {
+		newest := "-"
+		if s.Newest != nil {
+			newest = s.Newest.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			dash(s.Name), s.Kind, dash(s.Version), s.Backups, newest, s.Key, dash(s.InstallPath), dash(s.DBPath), dash(s.BackupPath))
+	}
+	w.Flush()
+
+	for _, s := range infos {
+		for _, e := range s.Errors {
+			if s.Name == "" {
+				// the service could not be read, only its key is known
+				fmt.Printf("error: %s: %s\n", s.Key, e)
+				continue
+			}
+			fmt.Printf("error: %s: %s\n", s.Name, e)
+		}
+	}
+}
+
+// dash returns "-" for an empty table cell
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// When the registry cannot be read, servers are found by searching the
+// Program Files and ProgramData folders, or the same folders under the
+// --discovery-root of a mounted disk, for the Building Operation folders:
+//
+//	Program Files\...\Building Operation 6.0\Enterprise Server\etc\dbpath.properties
+//	ProgramData\...\Building Operation 6.0\Enterprise Server\db_backup
+//
+// Each server is named after its folders, as its service would be, e.g.
+// `Building Operation 6.0 Enterprise Server`. The db folder of a server
+// without an install folder, or whose dbpath.properties points at a
+// folder that does not exist on a mounted disk, is taken from ProgramData.
+
+// maxSearchDepth limits how deep below each folder servers are searched for
+const maxSearchDepth = 5
+
+// fsLocator holds the servers found in the file system
+type fsLocator struct {
+	names    []string
+	services map[string]*eboService
+}
+
+func (l *fsLocator) ServiceKeys() ([]string, error) {
+	return l.names, nil
+}
+
+func (l *fsLocator) ReadService(key string) (*eboService, error) {
+	es, ok := l.services[strings.ToLower(key)]
+	if !ok {
+		return nil, fmt.Errorf("service `%s` not found", key)
+	}
+	s := *es
+	return &s, nil
+}
+
+// searchFolders returns the folders searched under the root, or the
+// standard folders of this computer when root is empty
+func searchFolders(root string) []string {
+
+	if root == "" {
+		var folders []string
+		for _, env := range []string{"ProgramFiles", "ProgramFiles(x86)", "ProgramData"} {
+			if dir := os.Getenv(env); dir != "" {
+				folders = append(folders, dir)
+			}
+		}
+		return folders
+	}
+
+	var folders []string
+	for _, name := range []string{"Program Files", "Program Files (x86)", "ProgramData"} {
+		dir := filepath.Join(root, name)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			folders = append(folders, dir)
+		}
+	}
+	if len(folders) == 0 {
+		folders = append(folders, root)
+	}
+	return folders
+}
+
+// newFSLocator searches the folders of the root for servers
+func newFSLocator(root string) (*fsLocator, error) {
+
+	if root != "" {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		root = abs
+	}
+
+	folders := searchFolders(root)
+	if len(folders) == 0 {
+		return nil, fmt.Errorf("no folders to search, use --discovery-root or --inventory")
+	}
+
+	l := &fsLocator{services: map[string]*eboService{}}
+	for _, folder := range folders {
+		if err := l.search(folder, root); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// search walks the folder for Enterprise Server and Enterprise Central
+// folders
+func (l *fsLocator) search(folder, root string) error {
+
+	return filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == folder {
+				return err
+			}
+			return nil // folders we may not read are skipped
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if rel, _ := filepath.Rel(folder, path); strings.Count(rel, string(filepath.Separator)) >= maxSearchDepth {
+			return fs.SkipDir
+		}
+		if serviceKind(d.Name()) == "" {
+			return nil
+		}
+
+		l.addFolder(path, root)
+		return fs.SkipDir
+	})
+}
+
+// addFolder records a server install or data folder
+func (l *fsLocator) addFolder(dir, root string) {
+
+	install := isFile(filepath.Join(dir, "etc", "dbpath.properties"))
+	data := isDir(filepath.Join(dir, es_backup_folder))
+	if !install && !data {
+		return
+	}
+
+	name := filepath.Base(filepath.Dir(dir)) + " " + filepath.Base(dir)
+	key := strings.ToLower(key_system_services + `\` + name)
+	es, ok := l.services[key]
+	if !ok {
+		es = &eboService{key: key_system_services + `\` + name, name: name}
+		l.services[key] = es
+		l.names = append(l.names, name)
+	}
+
+	if install {
+		es.image = filepath.Join(dir, "bin", "SE.SBO."+strings.ReplaceAll(filepath.Base(dir), " ", "")+".exe")
+		if db, err := readDBPath(dir); err == nil && !isDir(db) {
+			if rebased := rebasePath(root, db); rebased != "" && isDir(rebased) {
+				es.db = rebased
+			}
+		}
+	}
+	if data && (es.image == "" || es.db == "" && !dbExists(es)) {
+		es.db = filepath.Join(dir, "db")
+	}
+}
+
+// dbExists tests if the db folder of the server exists
+func dbExists(es *eboService) bool {
+	db, err := es.DBPath()
+	return err == nil && isDir(db)
+}
+
+// rebasePath moves an absolute path of the computer, such as
+// C:/ProgramData/..., under the root of a mounted disk
+func rebasePath(root, path string) string {
+	if root == "" {
+		return ""
+	}
+	path = filepath.FromSlash(path)
+	if len(path) >= 2 && path[1] == ':' {
+		path = path[2:]
+	}
+	return filepath.Join(root, strings.ReplaceAll(path, `\`, string(filepath.Separator)))
+}
+
+func isFile(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && !info.IsDir()
+}
+
+func isDir(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
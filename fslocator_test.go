@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// makeTree creates the folders and files under root. names ending in /
+// are folders, the others files with the given contents.
+func makeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, text := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		dir := path
+		if !strings.HasSuffix(name, "/") {
+			dir = filepath.Dir(path)
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if dir != path {
+			if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestRebasePath(t *testing.T) {
+
+	root := filepath.FromSlash("/mnt/disk")
+	tests := []struct {
+		root, path, want string
+	}{
+		{root, "C:/ProgramData/EBO/db", "/mnt/disk/ProgramData/EBO/db"},
+		{root, `C:\ProgramData\EBO\db`, "/mnt/disk/ProgramData/EBO/db"},
+		{root, "/ProgramData/EBO/db", "/mnt/disk/ProgramData/EBO/db"},
+		{"", "C:/ProgramData/EBO/db", ""},
+	}
+	for _, tt := range tests {
+		want := filepath.FromSlash(tt.want)
+		if got := rebasePath(tt.root, tt.path); got != want {
+			t.Errorf("%q under %q: got %q, want %q", tt.path, tt.root, got, want)
+		}
+	}
+}
+
+func TestFSLocator(t *testing.T) {
+
+	const (
+		files = "Program Files/Schneider Electric EcoStruxure/"
+		data  = "ProgramData/Schneider Electric EcoStruxure/"
+	)
+	root := t.TempDir()
+	makeTree(t, root, map[string]string{
+		// installed with its db moved to another folder of the disk
+		files + "Building Operation 6.0/Enterprise Server/etc/dbpath.properties": "server.paths.db=C:\\\\EBO\\\\db\n",
+		"EBO/db/": "",
+		data + "Building Operation 6.0/Enterprise Server/db_backup/": "",
+		// data moved to another drive that is not mounted
+		files + "Building Operation 7.0/Enterprise Server/etc/dbpath.properties": "server.paths.db=E:/Data/db\n",
+		data + "Building Operation 7.0/Enterprise Server/db_backup/":             "",
+		// data only, the install folder is gone
+		data + "Building Operation 5.0/Enterprise Central/db_backup/": "",
+		// not servers: no install or data, too deep and another product
+		data + "Building Operation 4.0/Enterprise Server/logs/":                "",
+		data + "a/b/c/d/e/Building Operation 6.0/Enterprise Server/db_backup/": "",
+		data + "Building Operation 6.0/WorkStation/db_backup/":                 "",
+	})
+
+	// as --discovery fs --discovery-root would
+	mode, dir := discoveryMode, discoveryRoot
+	discoveryMode, discoveryRoot = "fs", root
+	t.Cleanup(func() { discoveryMode, discoveryRoot = mode, dir })
+
+	found, err := findServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := map[string]*eboService{}
+	for _, s := range found {
+		if s.err != nil {
+			t.Errorf("%s: %v", s.key, s.err)
+			continue
+		}
+		services[s.service.name] = s.service
+	}
+
+	install := func(version, kind string) string {
+		return filepath.Join(root, filepath.FromSlash(files+"Building Operation "+version), kind)
+	}
+	db := func(version, kind string) string {
+		return filepath.Join(root, filepath.FromSlash(data+"Building Operation "+version), kind, "db")
+	}
+	tests := []struct {
+		name    string
+		install string
+		db      string
+	}{
+		{"Building Operation 6.0 Enterprise Server", install("6.0", "Enterprise Server"), filepath.Join(root, "EBO", "db")},
+		{"Building Operation 7.0 Enterprise Server", install("7.0", "Enterprise Server"), db("7.0", "Enterprise Server")},
+		{"Building Operation 5.0 Enterprise Central", "", db("5.0", "Enterprise Central")},
+	}
+	if len(services) != len(tests) {
+		t.Errorf("found %d servers, want %d", len(services), len(tests))
+	}
+	for _, tt := range tests {
+		es, ok := services[tt.name]
+		if !ok {
+			t.Errorf("%s: not found", tt.name)
+			continue
+		}
+		if got := es.InstallPath(); got != tt.install {
+			t.Errorf("%s: install %q, want %q", tt.name, got, tt.install)
+		}
+		if got, err := es.DBPath(); err != nil || got != tt.db {
+			t.Errorf("%s: db %q, %v, want %q", tt.name, got, err, tt.db)
+		}
+	}
+}
+
+func TestSearchFolders(t *testing.T) {
+
+	// a disk without the standard folders is searched from its root
+	root := t.TempDir()
+	if got := searchFolders(root); len(got) != 1 || got[0] != root {
+		t.Errorf("got %q, want the root", got)
+	}
+
+	makeTree(t, root, map[string]string{"ProgramData/": "", "Program Files/": "", "Users/": ""})
+	want := []string{filepath.Join(root, "Program Files"), filepath.Join(root, "ProgramData")}
+	if got := searchFolders(root); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"time"
@@ -8,34 +9,39 @@ import (
 	"github.com/secsy/goftp"
 )
 
-func (config *configSettings) uploadArchive(fileName string) {
+func (config *configSettings) uploadArchive(fileName string) error {
+
+	password, err := config.FtpPass.Resolve()
+	if err != nil {
+		return fmt.Errorf("FtpPass: %v", err)
+	}
 
 	ftpConfig := goftp.Config{
 		User:               config.FtpUser,
-		Password:           config.FtpPass,
+		Password:           password,
 		ConnectionsPerHost: 10,
 		Timeout:            10 * time.Second,
 		// Logger:             os.Stderr,
 	}
 	client, err := goftp.DialConfig(ftpConfig, config.FtpUri)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer client.Close()
 
 	// open source file
 	srcFile, err := os.Open(fileName)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer srcFile.Close()
 
-	destName := config.getFtpFile(fileName)
+	destName, err := config.getFtpFile(fileName)
+	if err != nil {
+		return err
+	}
 	log.Printf("uploading `%s`\n", destName)
 
 	// create destination file
-	err = client.Store(destName, srcFile)
-	if err != nil {
-		log.Fatal(err)
-	}
+	return client.Store(destName, srcFile)
 }
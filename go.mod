@@ -7,6 +7,7 @@ require (
 	github.com/secsy/goftp v0.0.0-20200609142545-aa2de14babf4
 	github.com/spf13/cobra v1.7.0
 	golang.org/x/sys v0.11.0
+	golang.org/x/term v0.10.0
 )
 
 require (
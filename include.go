@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// A config file can be layered on shared base files with `Include` (or
+// its alias `Extends`) at the top of the file:
+//
+//	Include      = "\\fileserver\ebobackup\fleet.config"
+//	ArchiveName  = "site42_{isoyear}W{isoweek}"
+//
+// The base files are read first, in the order listed, and the file that
+// includes them is applied last, so:
+//   - a key at the top of the including file overrides the top of the base
+//     file, and a key in its job section overrides that job of the base
+//   - a job section of any file overrides the keys at the top of every
+//     file, so the jobs of a base file keep their own folders
+//   - jobs with the same name are merged key by key, and jobs only in a
+//     base file are kept
+//   - the keys at the top of every file apply to every job
+//
+// A base file may include other files. Relative paths are relative to the
+// including file, or to its URL for a remote config, and environment
+// variables are expanded.
+
+// maxIncludeDepth limits how deep include files can be nested
+const maxIncludeDepth = 10
+
+func isIncludeKey(key string) bool {
+	return strings.EqualFold(key, "Include") || strings.EqualFold(key, "Extends")
+}
+
+// includes returns the include lines at the top of the file
+func (doc *configDoc) includes() []*configLine {
+	var lines []*configLine
+	for _, line := range doc.Lines {
+		if line.Header {
+			break
+		}
+		if isIncludeKey(line.Key) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// loadConfigDocs reads the config file and every file it includes. the
+// files are returned in the order they apply, base files first.
+func loadConfigDocs(configFile string) ([]*configDoc, error) {
+	var docs []*configDoc
+	err := loadConfigDoc(configFile, nil, map[string]bool{}, &docs)
+	return docs, err
+}
+
+func loadConfigDoc(name string, stack []string, loaded map[string]bool, docs *[]*configDoc) error {
+
+	key := includeKey(name)
+	for _, s := range stack {
+		if includeKey(s) == key {
+			return fmt.Errorf("%s includes itself: %s", name, strings.Join(append(stack, name), " -> "))
+		}
+	}
+	if len(stack) > maxIncludeDepth {
+		return fmt.Errorf("%s: includes are nested more than %d deep", name, maxIncludeDepth)
+	}
+	if loaded[key] {
+		return nil
+	}
+
+	file, err := readConfigFile(name)
+	if err != nil {
+		return err
+	}
+	doc, err := parseConfigDoc(name, file)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range doc.includes() {
+		path, err := expandEnv(line.Value)
+		if err != nil {
+			return &configError{name, line.Num, fmt.Sprintf("%s: %v", line.Key, err)}
+		}
+		if path == "" {
+			return &configError{name, line.Num, fmt.Sprintf("%s: no file given", line.Key)}
+		}
+		path, err = includePath(name, path)
+		if err != nil {
+			return &configError{name, line.Num, fmt.Sprintf("%s: %v", line.Key, err)}
+		}
+
+		err = loadConfigDoc(path, append(stack, name), loaded, docs)
+		if err != nil {
+			return &configError{name, line.Num, fmt.Sprintf("%s: %v", line.Key, err)}
+		}
+	}
+
+	loaded[key] = true
+	*docs = append(*docs, doc)
+	return nil
+}
+
+// includeKey returns the name used to find files included more than once
+func includeKey(name string) string {
+	if isRemoteConfig(name) {
+		return name
+	}
+	return strings.ToLower(filepath.Clean(name))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFiles writes the files to a temporary folder and returns it
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// loadTestJobs loads the jobs of a config file and its includes
+func loadTestJobs(t *testing.T, name string) ([]*configSettings, []*configError) {
+	t.Helper()
+	docs, err := loadConfigDocs(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs, warnings, err := parseConfigDocs(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jobs, warnings
+}
+
+func TestIncludeOverrides(t *testing.T) {
+
+	dir := writeConfigFiles(t, map[string]string{
+		"base.config": strings.Join([]string{
+			`Archive      = true`,
+			`ArchiveCount = 4`,
+			`[job.x]`,
+			`BackupFolder = "/out/x"`,
+			`ArchiveName  = "base"`,
+			`[job.old]`,
+			`BackupFolder = "/out/old"`,
+		}, "\n"),
+		"site.config": strings.Join([]string{
+			`Include      = "base.config"`,
+			`BackupFolder = "/out/site"`,
+			`ArchiveCount = 2`,
+			`[job.x]`,
+			`ArchiveName  = "site"`,
+			`[job.new]`,
+		}, "\n"),
+	})
+
+	selectJob(t, "")
+	jobs, _, err := readConfig(filepath.Join(dir, "site.config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("got %d jobs, want 3", len(jobs))
+	}
+
+	// the jobs of the base file keep their folders
+	x := findJob(jobs, "x")
+	if x.BackupFolder != "/out/x" {
+		t.Errorf("BackupFolder %q, the top of the site file should not override the base job", x.BackupFolder)
+	}
+	if x.ArchiveName != "site" || x.ArchiveCount != 2 || !x.Archive {
+		t.Errorf("merged job x: ArchiveName %q, ArchiveCount %d, Archive %v", x.ArchiveName, x.ArchiveCount, x.Archive)
+	}
+	if src := x.source("ArchiveName"); src.File != filepath.Join(dir, "site.config") || src.Line != 5 {
+		t.Errorf("ArchiveName source %v", src)
+	}
+	if old := findJob(jobs, "old"); old.BackupFolder != "/out/old" || old.ArchiveCount != 2 {
+		t.Errorf("base job old: BackupFolder %q, ArchiveCount %d", old.BackupFolder, old.ArchiveCount)
+	}
+	if n := findJob(jobs, "new"); n.BackupFolder != "/out/site" {
+		t.Errorf("site job new: BackupFolder %q", n.BackupFolder)
+	}
+}
+
+func TestJobSectionOverridesTopOfSameFile(t *testing.T) {
+
+	dir := writeConfigFiles(t, map[string]string{
+		"site.config": "BackupFolder = /out/all\nbogus = 1\n[job.a]\nBackupFolder = /out/a\n[job.b]\n",
+	})
+
+	jobs, warnings := loadTestJobs(t, filepath.Join(dir, "site.config"))
+	if a := findJob(jobs, "a"); a.BackupFolder != "/out/a" {
+		t.Errorf("job a: BackupFolder %q", a.BackupFolder)
+	}
+	if b := findJob(jobs, "b"); b.BackupFolder != "/out/all" {
+		t.Errorf("job b: BackupFolder %q", b.BackupFolder)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("got warnings %v, want one for the unknown key", warnings)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+
+	dir := writeConfigFiles(t, map[string]string{
+		"a.config": `Include = "b.config"`,
+		"b.config": `Include = "a.config"`,
+	})
+	_, err := loadConfigDocs(filepath.Join(dir, "a.config"))
+	if err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("got error %v, want a cycle", err)
+	}
+}
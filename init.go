@@ -1,59 +1,226 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func initializeConfig() {
+var initServer string
+var initInteractive bool
 
-	var c configSettings
-	n := defaultConfigFile
+// initializeConfig creates a new config file. the ES backup path is taken
+// from a discovered server and every setting can be given with its flag or
+// answered at the prompts in interactive mode.
+func initializeConfig(n string) error {
 
 	if _, err := os.Stat(n); err == nil {
-		// config file exists return
-		fmt.Println("exiting, config file already exists.")
-		return
+		return fmt.Errorf("config file '%s' already exists", n)
 	}
 
-	// get last ES backup location and use as the default
-	ess, err := EnterpriseServers()
+	c := defaultConfig()
+
+	// suggested values for a new site, the folders next to the config file
+	dir, err := filepath.Abs(filepath.Dir(n))
 	if err != nil {
-		return
-	}
-	if len(ess) > 0 {
-		es := ess[len(ess)-1]
-		dbPath, _ := es.DBBackupPath()
-		c.ESBackupPath = dbPath
+		return err
 	}
-
-	// set some default values
-	c.BackupFolder = "c:\\ebobackup\\eb_backup"
-	c.ArchiveFolder = "c:\\ebobackup\\archives"
+	c.BackupFolder = filepath.Join(dir, "eb_backup")
+	c.ArchiveFolder = filepath.Join(dir, "archives")
 	c.Archive = true
 	c.ArchiveCount = 5
 	c.ArchiveName = "my_site_backups"
 	c.ArchiveISOWeek = true
 
+	var in *bufio.Reader
+	if initInteractive {
+		in = bufio.NewReader(os.Stdin)
+	}
+
+	ess, err := Servers()
+	if err != nil {
+		log.Printf("warning: server discovery failed: %v\n", err)
+	}
+
+	es, err := chooseServer(ess, initServer, in)
+	if err != nil {
+		return err
+	}
+	if es != nil {
+		dbPath, err := es.DBBackupPath()
+		if err != nil {
+			log.Printf("warning: backup path of `%s` not found: %v\n", es.name, err)
+		}
+		c.ESBackupPath = dbPath
+		c.ServerKind = string(es.kind)
+	}
+
+	// only the flags given to init are written, the environment may hold
+	// settings such as FtpPass that are kept out of the file
+	if err := c.applyFlags(); err != nil {
+		return err
+	}
+
+	if in != nil {
+		if err := promptSettings(in, os.Stdout, &c); err != nil {
+			return err
+		}
+	}
+
 	f, err := os.Create(n)
 	if err != nil {
-		return
-	}
-
-	_, _ = fmt.Fprintf(f, "ESBackupPath      = %q  # Enter the path to the ES backups 'db_backup'\n", c.ESBackupPath)
-	_, _ = fmt.Fprintf(f, "BackupFolder      = %q  # the path to copy the backups to\n", c.BackupFolder)
-	_, _ = fmt.Fprintf(f, "Archive           = %v  # flag to create archive file\n", c.Archive)
-	_, _ = fmt.Fprintf(f, "ArchiveCount      = %v  # number of archive files to keep\n", c.ArchiveCount)
-	_, _ = fmt.Fprintf(f, "ArchiveFolder     = %q  # the path to save an archive zip of all the backups\n", c.ArchiveFolder)
-	_, _ = fmt.Fprintf(f, "ArchiveName       = %q  # name of the archive file\n", c.ArchiveName)
-	_, _ = fmt.Fprintf(f, "ArchiveISOWeek    = %v  # add ISO week number to the archive name\n", c.ArchiveISOWeek)
-	_, _ = fmt.Fprintf(f, "ArchiveAddYear    = %v  # add year to the archive name\n", c.ArchiveAddYear)
-	_, _ = fmt.Fprintf(f, "ArchiveAddMonth   = %v  # add month to the archive name\n", c.ArchiveAddMonth)
-	_, _ = fmt.Fprintf(f, "Ftp               = %v  # flag to upload to an ftp server\n", c.Ftp)
-	_, _ = fmt.Fprintf(f, "FtpUri            = %q  # URI of the ftp server\n", c.FtpUri)
-	_, _ = fmt.Fprintf(f, "FtpUser           = %q  # ftp user name\n", c.FtpUser)
-	_, _ = fmt.Fprintf(f, "FtpPass           = %q  # ftp password\n", c.FtpPass)
-	_, _ = fmt.Fprintf(f, "FtpWeekday        = %q  # day to upload the file\n", c.FtpWeekday)
-	_, _ = fmt.Fprintf(f, "# Valid Weekdays  = Sunday, Monday, Tuesday, Wednesday, Thursday, Friday, Saturday\n")
+		return err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "# %s configuration, created %s by %s version %s\n", exeName, time.Now().Format("2006-01-02"), exeName, strings.TrimSpace(version))
+	fmt.Fprintf(f, "# keys are not case sensitive, quoted values are used as written and '#' starts a comment.\n\n")
+	if err := writeConfig(f, &c); err != nil {
+		return err
+	}
+
+	fmt.Printf("created %s\n", n)
+	return nil
+}
+
+// chooseServer picks the server to back up. a server given by name must
+// match one discovered server; otherwise the user is asked in interactive
+// mode, or the last Enterprise Server found is used.
+func chooseServer(ess []*eboService, name string, in *bufio.Reader) (*eboService, error) {
+
+	if name != "" {
+		return findServer(ess, name)
+	}
+
+	if len(ess) == 0 {
+		fmt.Println("no enterprise servers found, ESBackupPath must be set in the config file")
+		return nil, nil
+	}
 
+	// the last Enterprise Server, or the last server if there is none
+	last := len(ess)
+	for i, es := range ess {
+		if es.kind == kindEnterpriseServer {
+			last = i + 1
+		}
+	}
+
+	if in == nil {
+		es := ess[last-1]
+		if len(ess) > 1 {
+			fmt.Printf("found %d servers, using `%s`. use --server to choose another.\n", len(ess), es.name)
+		}
+		return es, nil
+	}
+
+	fmt.Println("servers found:")
+	for i, es := range ess {
+		dbPath, err := es.DBBackupPath()
+		if err != nil {
+			dbPath = err.Error()
+		}
+		fmt.Printf("  %d) %s (%s) : %s\n", i+1, es.name, es.kind.title(), dbPath)
+	}
+
+	for {
+		answer, err := prompt(in, os.Stdout, "server to back up", strconv.Itoa(last))
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 1 && n <= len(ess) {
+			return ess[n-1], nil
+		}
+		fmt.Printf("enter a number from 1 to %d\n", len(ess))
+	}
+}
+
+// findServer returns the server with the display name. a part of the name
+// can be used if it matches a single server.
+func findServer(ess []*eboService, name string) (*eboService, error) {
+
+	var matches []*eboService
+	for _, es := range ess {
+		if strings.EqualFold(es.name, name) {
+			return es, nil
+		}
+		if strings.Contains(strings.ToLower(es.name), strings.ToLower(name)) {
+			matches = append(matches, es)
+		}
+	}
+
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return nil, fmt.Errorf("no server matches %q, run `%s find` to list the servers", name, exeName)
+	}
+
+	names := make([]string, len(matches))
+	for i, es := range matches {
+		names[i] = es.name
+	}
+	return nil, fmt.Errorf("%q matches several servers: %s", name, strings.Join(names, ", "))
+}
+
+// promptSettings asks for the value of every setting. the archive and ftp
+// settings are skipped when archive or ftp is turned off. an empty answer
+// keeps the current value.
+func promptSettings(in *bufio.Reader, out io.Writer, c *configSettings) error {
+
+	for i := range configFields {
+		f := &configFields[i]
+
+		if (strings.HasPrefix(f.Name, "Archive") && f.Name != "Archive" && !c.Archive) ||
+			(strings.HasPrefix(f.Name, "Ftp") && f.Name != "Ftp" && !c.Ftp) {
+			continue
+		}
+
+		// a secret shows its reference, e.g. env:NAME, or is masked
+		current := f.get(c)
+		if f.Type == fieldSecret {
+			if s := reflect.ValueOf(c).Elem().FieldByName(f.Name).Interface().(secret); s.IsRef() {
+				current = s.Ref
+			}
+		}
+
+		for {
+			answer, err := prompt(in, out, fmt.Sprintf("%s, %s", f.Name, f.Desc), current)
+			if err != nil {
+				return err
+			}
+			if answer == current {
+				break
+			}
+			err = f.set(c, answer)
+			if err == nil {
+				break
+			}
+			fmt.Fprintln(out, err)
+		}
+	}
+	return nil
+}
+
+// prompt asks a question and returns the answer, or the default value if
+// the answer is empty or the input has ended
+func prompt(in *bufio.Reader, out io.Writer, question, value string) (string, error) {
+
+	fmt.Fprintf(out, "%s [%s]: ", question, value)
+	answer, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return value, nil
+	}
+	return answer, nil
 }
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// ServerLocator finds the services installed on a computer. The services
+// are read from the registry on Windows, or from an inventory file given
+// with --inventory:
+//
+//	[
+//	  {
+//	    "service": "Building Operation 6.0 Enterprise Server",
+//	    "displayName": "Building Operation 6.0 Enterprise Server",
+//	    "imagePath": "C:\\Program Files\\...\\bin\\SE.SBO.EnterpriseServer.exe"
+//	  }
+//	]
+//
+// or a .reg file exported from the Services key with regedit.
+type ServerLocator interface {
+	// ServiceKeys returns the names of the services
+	ServiceKeys() ([]string, error)
+	// ReadService reads the service with the registry key
+	// SYSTEM\CurrentControlSet\Services\NAME
+	ReadService(key string) (*eboService, error)
+}
+
+// inventoryFile is the file servers are read from instead of the registry
+var inventoryFile = os.Getenv(envPrefix + "INVENTORY")
+
+// discoveryMode is how servers are found: auto, registry, fs or inventory
+var discoveryMode = os.Getenv(envPrefix + "DISCOVERY")
+
+// discoveryRoot is the folder searched in fs mode, e.g. a mounted disk
+var discoveryRoot = os.Getenv(envPrefix + "DISCOVERY_ROOT")
+
+// serverLocator returns the locator of the discovery mode. in auto mode
+// an inventory file or discovery root is used when given, then the
+// registry, and the file system when the registry cannot be read.
+func serverLocator() (ServerLocator, error) {
+
+	switch strings.ToLower(discoveryMode) {
+	case "inventory":
+		if inventoryFile == "" {
+			return nil, fmt.Errorf("discovery mode inventory needs --inventory")
+		}
+		return readInventory(inventoryFile)
+	case "registry":
+		return defaultLocator()
+	case "fs":
+		return newFSLocator(discoveryRoot)
+	case "", "auto":
+	default:
+		return nil, fmt.Errorf("unknown discovery mode %q, use auto, registry, fs or inventory", discoveryMode)
+	}
+
+	switch {
+	case inventoryFile != "":
+		return readInventory(inventoryFile)
+	case discoveryRoot != "":
+		return newFSLocator(discoveryRoot)
+	}
+
+	locator, err := defaultLocator()
+	if err == nil {
+		_, err = locator.ServiceKeys()
+	}
+	if err == nil {
+		return locator, nil
+	}
+	log.Printf("warning: %v, searching the file system for servers\n", err)
+	return newFSLocator("")
+}
+
+// fileLocator holds the services read from an inventory file. the values
+// of each service are keyed by their lower case registry key.
+type fileLocator struct {
+	names    []string
+	services map[string]map[string]string
+}
+
+func (l *fileLocator) ServiceKeys() ([]string, error) {
+	return l.names, nil
+}
+
+func (l *fileLocator) ReadService(key string) (*eboService, error) {
+
+	values, ok := l.services[strings.ToLower(key)]
+	if !ok {
+		return nil, fmt.Errorf("service `%s` not found", key)
+	}
+
+	displayName, ok := values["displayname"]
+	if !ok {
+		return nil, fmt.Errorf("service `%s` has no DisplayName", key)
+	}
+	imagePath, ok := values["imagepath"]
+	if !ok {
+		return nil, fmt.Errorf("service `%s` has no ImagePath", key)
+	}
+
+	return &eboService{
+		key:   key,
+		name:  displayName,
+		image: trimQuote(imagePath),
+	}, nil
+}
+
+// values returns the values of a service, adding the service if it is new
+func (l *fileLocator) values(service string) map[string]string {
+	key := strings.ToLower(key_system_services + `\` + service)
+	if _, ok := l.services[key]; !ok {
+		l.names = append(l.names, service)
+		l.services[key] = map[string]string{}
+	}
+	return l.services[key]
+}
+
+// add records a value of a service
+func (l *fileLocator) add(service, name, value string) {
+	l.values(service)[strings.ToLower(name)] = value
+}
+
+// readInventory reads a json inventory or .reg file
+func readInventory(name string) (*fileLocator, error) {
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &fileLocator{services: map[string]map[string]string{}}
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		err = l.readJSON(b)
+	} else {
+		err = l.readReg(decodeText(b))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("inventory %s: %v", name, err)
+	}
+	return l, nil
+}
+
+// inventoryService is a service in a json inventory
+type inventoryService struct {
+	Service     string `json:"service"`
+	DisplayName string `json:"displayName"`
+	ImagePath   string `json:"imagePath"`
+}
+
+func (l *fileLocator) readJSON(b []byte) error {
+
+	var services []inventoryService
+	if err := json.Unmarshal(b, &services); err != nil {
+		return err
+	}
+	for i, s := range services {
+		if s.Service == "" {
+			return fmt.Errorf("service %d has no name", i+1)
+		}
+		l.values(s.Service)
+		if s.DisplayName != "" {
+			l.add(s.Service, "DisplayName", s.DisplayName)
+		}
+		if s.ImagePath != "" {
+			l.add(s.Service, "ImagePath", s.ImagePath)
+		}
+	}
+	return nil
+}
+
+// readReg reads the services from a regedit export:
+//
+//	[HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Services\NAME]
+//	"DisplayName"="Building Operation 6.0 Enterprise Server"
+//	"ImagePath"=hex(2):22,00,43,00,...
+//
+// keys outside the Services key and values other than strings are
+// ignored.
+func (l *fileLocator) readReg(text string) error {
+
+	prefix := strings.ToLower(key_system_services) + `\`
+	service := ""
+	num := 0
+
+	s := bufio.NewScanner(strings.NewReader(text))
+	for s.Scan() {
+		num++
+		line := strings.TrimSpace(s.Text())
+
+		// hex values continue on the next line after a trailing backslash
+		for strings.HasSuffix(line, `\`) && s.Scan() {
+			num++
+			line = line[:len(line)-1] + strings.TrimSpace(s.Text())
+		}
+
+		switch {
+		case line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "Windows Registry Editor") || line == "REGEDIT4":
+			continue
+
+		case strings.HasPrefix(line, "["):
+			key := strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			_, key, _ = strings.Cut(key, `\`) // drop the hive
+			service = ""
+			if rest, ok := strings.CutPrefix(strings.ToLower(key), prefix); ok && !strings.Contains(rest, `\`) {
+				service = key[len(prefix):]
+			}
+			continue
+		}
+
+		if service == "" || !strings.HasPrefix(line, `"`) {
+			continue
+		}
+
+		name, rest, err := regString(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", num, err)
+		}
+		rest, ok := strings.CutPrefix(rest, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected =", num)
+		}
+
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			value, _, err := regString(rest)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", num, err)
+			}
+			l.add(service, name, value)
+
+		case strings.HasPrefix(rest, "hex(2):"), strings.HasPrefix(rest, "hex(1):"):
+			value, err := regHexString(rest[len("hex(2):"):])
+			if err != nil {
+				return fmt.Errorf("line %d: %v", num, err)
+			}
+			l.add(service, name, value)
+		}
+	}
+	return s.Err()
+}
+
+// regString reads a quoted .reg string with \\ and \" escapes and returns
+// the text after it
+func regString(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+			if i < len(s) {
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("missing closing quote in %s", s)
+}
+
+// regHexString decodes the comma separated UTF-16 bytes of an expandable
+// string value
+func regHexString(s string) (string, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, ",", ""))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(decodeUTF16(b), "\x00"), nil
+}
+
+// decodeText returns the text of a file that may be UTF-16, as regedit
+// writes, or UTF-8
+func decodeText(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return decodeUTF16(b[2:])
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return string(b[3:])
+	}
+	return string(b)
+}
+
+// decodeUTF16 decodes little endian UTF-16
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// useInventory makes discovery read the inventory file for the test
+func useInventory(t *testing.T, name string) {
+	t.Helper()
+	file, mode := inventoryFile, discoveryMode
+	inventoryFile, discoveryMode = name, "inventory"
+	t.Cleanup(func() { inventoryFile, discoveryMode = file, mode })
+}
+
+// encodeUTF16 encodes text as regedit writes it: UTF-16 little endian
+// with a byte order mark
+func encodeUTF16(s string) []byte {
+	b := []byte{0xff, 0xfe}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return b
+}
+
+// regHex writes a string as the comma separated UTF-16 bytes of a hex(2)
+// value
+func regHex(s string) string {
+	b := encodeUTF16(s + "\x00")[2:]
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = hex.EncodeToString([]byte{c})
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestInventoryJSON(t *testing.T) {
+
+	dir := writeConfigFiles(t, map[string]string{
+		"inventory.json": `[
+  {"service": "Building Operation 6.0 Enterprise Server", "displayName": "Building Operation 6.0 Enterprise Server", "imagePath": "\"C:\\EBO\\6.0\\Enterprise Server\\bin\\SE.SBO.EnterpriseServer.exe\""},
+  {"service": "Building Operation 6.0 Enterprise Central", "displayName": "Building Operation 6.0 Enterprise Central", "imagePath": "C:\\EBO\\6.0\\Enterprise Central\\bin\\SE.SBO.EnterpriseCentral.exe"},
+  {"service": "Building Operation 5.0 Enterprise Server", "displayName": "Building Operation 5.0 Enterprise Server"},
+  {"service": "Spooler", "displayName": "Print Spooler", "imagePath": "spoolsv.exe"}
+]`,
+	})
+	useInventory(t, filepath.Join(dir, "inventory.json"))
+
+	ess, err := EnterpriseServers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ess) != 1 {
+		t.Fatalf("got %d enterprise servers, want 1", len(ess))
+	}
+	es := ess[0]
+	if es.name != "Building Operation 6.0 Enterprise Server" || es.kind != kindEnterpriseServer {
+		t.Errorf("got %q of kind %s", es.name, es.kind)
+	}
+	if want := `C:\EBO\6.0\Enterprise Server\bin\SE.SBO.EnterpriseServer.exe`; es.image != want {
+		t.Errorf("image %q, want %q", es.image, want)
+	}
+
+	found, err := findServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 {
+		t.Fatalf("found %d services, want 3", len(found))
+	}
+	if found[2].err == nil || !strings.Contains(found[2].err.Error(), "ImagePath") {
+		t.Errorf("service without ImagePath: error %v", found[2].err)
+	}
+
+	all, err := Servers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[1].kind != kindEnterpriseCentral {
+		t.Errorf("got %d servers, want the enterprise server and central", len(all))
+	}
+}
+
+func TestInventoryReg(t *testing.T) {
+
+	image := `"C:\EBO\7.0\Enterprise Server\bin\SE.SBO.EnterpriseServer.exe"`
+	hexImage := regHex(image)
+	reg := strings.Join([]string{
+		`Windows Registry Editor Version 5.00`,
+		``,
+		`[HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Services\Building Operation 7.0 Enterprise Server]`,
+		`"DisplayName"="Building Operation 7.0 \"Main\" Enterprise Server"`,
+		`"ImagePath"=hex(2):` + hexImage[:59] + `,\`,
+		`  ` + hexImage[60:],
+		`"Start"=dword:00000002`,
+		``,
+		`[HKEY_LOCAL_MACHINE\SYSTEM\CurrentControlSet\Services\Building Operation 7.0 Enterprise Server\Parameters]`,
+		`"DisplayName"="not a service"`,
+		``,
+		`[HKEY_LOCAL_MACHINE\SOFTWARE\Other]`,
+		`"ImagePath"="ignored"`,
+	}, "\r\n")
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "services.reg")
+	if err := os.WriteFile(name, encodeUTF16(reg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	useInventory(t, name)
+
+	ess, err := EnterpriseServers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ess) != 1 {
+		t.Fatalf("got %d enterprise servers, want 1", len(ess))
+	}
+	if want := `Building Operation 7.0 "Main" Enterprise Server`; ess[0].name != want {
+		t.Errorf("name %q, want %q", ess[0].name, want)
+	}
+	if want := trimQuote(image); ess[0].image != want {
+		t.Errorf("image %q, want %q", ess[0].image, want)
+	}
+}
+
+func TestDBPath(t *testing.T) {
+
+	dir := t.TempDir()
+	install := filepath.Join(dir, "Enterprise Server")
+	db := filepath.Join(dir, "data", "db")
+	props := "# db folder\nserver.paths.db = " + strings.ReplaceAll(filepath.ToSlash(db), ":", `\:`) + "\n"
+	if err := os.MkdirAll(filepath.Join(install, "etc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(install, "etc", "dbpath.properties"), []byte(props), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	es := &eboService{image: filepath.Join(install, "bin", "SE.SBO.EnterpriseServer.exe")}
+	if got := es.InstallPath(); got != install {
+		t.Errorf("InstallPath %q, want %q", got, install)
+	}
+	if got, err := es.DBPath(); err != nil || got != db {
+		t.Errorf("DBPath %q, %v, want %q", got, err, db)
+	}
+	if got, err := es.DBBackupPath(); err != nil || got != filepath.Join(dir, "data", "db_backup") {
+		t.Errorf("DBBackupPath %q, %v", got, err)
+	}
+
+	// a server found by its data folder only
+	data := &eboService{db: filepath.Join(dir, "other", "db")}
+	if got, err := data.DBBackupPath(); err != nil || got != filepath.Join(dir, "other", "db_backup") {
+		t.Errorf("DBBackupPath of a data folder %q, %v", got, err)
+	}
+	if _, err := data.Properties(); err != ErrNoInstall {
+		t.Errorf("Properties of a data folder: %v, want ErrNoInstall", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(install, "etc", "dbpath.properties"), []byte("other=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := es.DBPath(); err != ErrNotFound {
+		t.Errorf("DBPath without server.paths.db: %v, want ErrNotFound", err)
+	}
+
+	missing := &eboService{image: filepath.Join(dir, "missing", "bin", "x.exe")}
+	if _, err := missing.DBPath(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("DBPath without dbpath.properties: %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var migrateDryRun bool
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "upgrade the configuration file to the current layout",
+	Long: `Upgrade the configuration file to the current layout.
+
+	comments and values are kept, keys are renamed to their current
+	names and missing keys are added with their default values. the
+	original file is saved next to it with a .bak extension.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := getConfigFile()
+		if err != nil {
+			log.Printf("Error config file '%s' not found!\n", file)
+			cmd.Usage()
+			return
+		}
+
+		if isRemoteConfig(file) {
+			log.Fatalf("%s is a remote config, migrate the file on the server", file)
+		}
+
+		original, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		doc, err := parseConfigDoc(file, original)
+		if err != nil {
+			log.Fatalf("fix the errors before migrating:\n%v", err)
+		}
+
+		changes, err := migrateConfig(doc)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(changes) == 0 {
+			fmt.Printf("%s is up to date\n", file)
+			return
+		}
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+		if migrateDryRun {
+			return
+		}
+
+		backup := fmt.Sprintf("%s.%s.bak", file, time.Now().Format("20060102-150405"))
+		if err := os.WriteFile(backup, original, 0o644); err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(file, doc.Bytes(), 0o644); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("saved the original file as %s\n", backup)
+	},
+}
+
+// configMigration upgrades a config file to Version from the version
+// before it. it returns a description of each change made.
+type configMigration struct {
+	Version int
+	Apply   func(doc *configDoc) []string
+}
+
+// configMigrations are the upgrade steps in version order
+var configMigrations = []configMigration{
+	{2, migrateKeyNames},
+}
+
+// migrateConfig upgrades the config file to the current layout and returns
+// the changes made. missing keys are added with their default values after
+// the steps for each newer version are applied, unless the file includes a
+// base file. included files are not changed.
+func migrateConfig(doc *configDoc) ([]string, error) {
+
+	version, versionLine := docVersion(doc)
+	if version > configVersion {
+		return nil, fmt.Errorf("%s %d is newer than this version of %s supports", versionKey, version, exeName)
+	}
+
+	var changes []string
+	for _, m := range configMigrations {
+		if m.Version > version {
+			changes = append(changes, m.Apply(doc)...)
+		}
+	}
+
+	// keys missing from a file that includes a base file are set by the
+	// base, adding their defaults would override it
+	if len(doc.includes()) == 0 {
+		changes = append(changes, addMissingKeys(doc)...)
+	}
+
+	if version < configVersion {
+		changes = append(changes, fmt.Sprintf("%s: %d -> %d", versionKey, version, configVersion))
+		if versionLine != nil {
+			versionLine.setValue(strconv.Itoa(configVersion))
+		} else {
+			doc.insert(firstSettingLine(doc), fmt.Sprintf("%-17s = %d  # version of the config file layout", versionKey, configVersion))
+		}
+	}
+
+	// check the result reads back and refresh the line numbers
+	migrated, err := parseConfigDoc(doc.Name, doc.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	*doc = *migrated
+	return changes, nil
+}
+
+// docVersion returns the layout version of the file and the line it is
+// set on. files without a version are version 1.
+func docVersion(doc *configDoc) (int, *configLine) {
+	for _, line := range doc.Lines {
+		if line.Section == nil && strings.EqualFold(line.Key, versionKey) {
+			v, err := strconv.Atoi(line.Value)
+			if err != nil {
+				return 1, line
+			}
+			return v, line
+		}
+	}
+	return 1, nil
+}
+
+// firstSettingLine returns the index of the first key or section line
+func firstSettingLine(doc *configDoc) int {
+	for i, line := range doc.Lines {
+		if line.Key != "" || line.Header {
+			return i
+		}
+	}
+	return len(doc.Lines)
+}
+
+// migrateKeyNames renames keys to the spelling used by the schema, e.g.
+// ArchiveWeekDay to ArchiveWeekday
+func migrateKeyNames(doc *configDoc) []string {
+	var changes []string
+	for _, line := range doc.Lines {
+		if line.Key == "" {
+			continue
+		}
+		f := findField(sectionFields(line.Section), line.Key)
+		if f == nil || f.Name == line.Key {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("line %d: renamed %s to %s", line.Num, line.Key, f.Name))
+		line.renameKey(f.Name)
+	}
+	return changes
+}
+
+// addMissingKeys adds the settings missing from the top of the file with
+// their default values, after the last key before any section
+func addMissingKeys(doc *configDoc) []string {
+
+	found := map[*configField]bool{}
+	last := -1
+	for i, line := range doc.Lines {
+		if line.Header {
+			break
+		}
+		if line.Key == "" {
+			continue
+		}
+		last = i
+		if f := lookupField(line.Key); f != nil {
+			found[f] = true
+		}
+	}
+	if last < 0 {
+		last = firstSettingLine(doc) - 1
+	}
+
+	var changes []string
+	var lines []string
+	for i := range configFields {
+		f := &configFields[i]
+		if found[f] {
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("added %s = %s", f.Name, formatConfigValue(f, f.Default)))
+		lines = append(lines, formatConfigLine(f, f.Default))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	lines = append([]string{fmt.Sprintf("# added by %s config migrate on %s", exeName, time.Now().Format("2006-01-02"))}, lines...)
+	doc.insert(last+1, lines...)
+	return changes
+}
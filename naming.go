@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ArchiveName and FtpName may be templates with {token} names:
+//
+//	{name}      job name, "default" for a config without jobs
+//	{yyyy}      year
+//	{mm}        month, 01 to 12
+//	{dd}        day of the month, 01 to 31
+//	{isoyear}   ISO 8601 year of the week
+//	{isoweek}   ISO 8601 week number, 01 to 53
+//	{weekday}   day of the week, e.g. Monday
+//	{host}      computer name
+//	{esversion} EBO version from ESBackupPath, e.g. 6.0
+//
+// A name without tokens is extended by the ArchiveISOWeek, ArchiveWeekday,
+// ArchiveAddYear, ArchiveAddMonth, FtpAddYear and FtpAddMonth flags as
+// before, see archiveTemplate and ftpTemplate.
+
+var tokenPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// isTemplate tests if the name contains tokens
+func isTemplate(name string) bool {
+	return tokenPattern.MatchString(name)
+}
+
+// expandTemplate replaces every {token} in s with the value from lookup.
+// an unknown token is an error.
+func expandTemplate(s string, lookup func(token string) (string, error)) (string, error) {
+	var err error
+	result := tokenPattern.ReplaceAllStringFunc(s, func(t string) string {
+		v, e := lookup(strings.ToLower(t[1 : len(t)-1]))
+		if e != nil && err == nil {
+			err = e
+		}
+		return v
+	})
+	return result, err
+}
+
+// nameToken returns the value of a naming token at the time t
+func (config *configSettings) nameToken(t time.Time) func(string) (string, error) {
+	return func(token string) (string, error) {
+		isoYear, isoWeek := t.ISOWeek()
+		switch token {
+		case "name":
+			return config.jobName(), nil
+		case "yyyy":
+			return fmt.Sprintf("%04d", t.Year()), nil
+		case "mm":
+			return fmt.Sprintf("%02d", t.Month()), nil
+		case "dd":
+			return fmt.Sprintf("%02d", t.Day()), nil
+		case "isoyear":
+			return fmt.Sprintf("%04d", isoYear), nil
+		case "isoweek":
+			return fmt.Sprintf("%02d", isoWeek), nil
+		case "weekday":
+			return t.Weekday().String(), nil
+		case "host":
+			return os.Hostname()
+		case "esversion":
+			v := eboVersion(config.ESBackupPath)
+			if v == "" {
+				return "", fmt.Errorf("no EBO version found in ESBackupPath `%s`", config.ESBackupPath)
+			}
+			return v, nil
+		}
+		return "", fmt.Errorf("unknown token {%s}", token)
+	}
+}
+
+var versionPattern = regexp.MustCompile(`(?i)Building Operation (\d+(?:\.\d+)*)`)
+
+// eboVersion returns the EBO version from a path or service name such as
+// `...\Building Operation 6.0\Enterprise Server`, or an empty string
+func eboVersion(s string) string {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// splitExt splits the extension from a name template. an extension that
+// contains a token is part of the name.
+func splitExt(name string) (string, string) {
+	i := strings.LastIndexByte(name, '.')
+	if i < 0 || strings.ContainsAny(name[i:], `{}/\`) {
+		return name, ""
+	}
+	return name[:i], name[i:]
+}
+
+// archiveTemplate returns the template for the archive name without its
+// extension. a plain ArchiveName is extended by the archive flags.
+func (config *configSettings) archiveTemplate() string {
+
+	name, _ := splitExt(config.ArchiveName)
+	if isTemplate(name) {
+		return name
+	}
+
+	switch {
+	case config.ArchiveISOWeek:
+		return name + "_{isoyear}W{isoweek}"
+	case config.ArchiveWeekday:
+		return name + "_{weekday}"
+	}
+	if config.ArchiveAddYear {
+		name += "_{yyyy}"
+	}
+	if config.ArchiveAddMonth {
+		name += "_{mm}"
+	}
+	return name
+}
+
+// ftpTemplate returns the template for the uploaded file name without its
+// extension. FtpName defaults to ArchiveName, and a plain name is extended
+// by the ftp flags.
+func (config *configSettings) ftpTemplate(ext string) string {
+
+	name := config.FtpName
+	if name == "" {
+		name = config.ArchiveName
+	}
+	if isTemplate(name) {
+		base, _ := splitExt(name)
+		return base
+	}
+
+	name = strings.TrimSuffix(name, ext)
+	if config.FtpAddYear {
+		name += "_{yyyy}"
+	}
+	if config.FtpAddMonth {
+		name += "_{mm}"
+	}
+	return name
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArchiveTemplate(t *testing.T) {
+
+	// 2024-12-30 is a Monday in ISO week 1 of 2025
+	now := time.Date(2024, 12, 30, 2, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		config configSettings
+		want   string
+	}{
+		{configSettings{ArchiveName: "site.zip"}, "site"},
+		{configSettings{ArchiveName: "site.zip", ArchiveISOWeek: true}, "site_2025W01"},
+		{configSettings{ArchiveName: "site.zip", ArchiveWeekday: true}, "site_Monday"},
+		{configSettings{ArchiveName: "site", ArchiveAddYear: true, ArchiveAddMonth: true}, "site_2024_12"},
+		{configSettings{Name: "es60", ArchiveName: "{name}_{yyyy}-{mm}-{dd}.zip", ArchiveISOWeek: true}, "es60_2024-12-30"},
+		{configSettings{ArchiveName: "{NAME}.{isoyear}W{isoweek}"}, "default.2025W01"},
+		{configSettings{ArchiveName: "es{esversion}", ESBackupPath: `C:\ProgramData\Building Operation 6.0\Enterprise Server\db_backup`}, "es6.0"},
+	}
+	for _, tt := range tests {
+		got, err := expandTemplate(tt.config.archiveTemplate(), tt.config.nameToken(now))
+		if err != nil {
+			t.Errorf("%q: %v", tt.config.ArchiveName, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.config.ArchiveName, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTemplateErrors(t *testing.T) {
+
+	config := configSettings{ESBackupPath: `D:\backups`}
+	for _, name := range []string{"{week}", "{esversion}"} {
+		if _, err := expandTemplate(name, config.nameToken(time.Now())); err == nil {
+			t.Errorf("%q: no error", name)
+		}
+	}
+}
+
+func TestFtpTemplate(t *testing.T) {
+
+	tests := []struct {
+		config configSettings
+		want   string
+	}{
+		{configSettings{ArchiveName: "site.zip"}, "site"},
+		{configSettings{ArchiveName: "site.zip", FtpName: "offsite.zip", FtpAddYear: true}, "offsite_{yyyy}"},
+		{configSettings{ArchiveName: "site_{isoweek}.zip", FtpAddMonth: true}, "site_{isoweek}"},
+	}
+	for _, tt := range tests {
+		if got := tt.config.ftpTemplate(".zip"); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestSplitExt(t *testing.T) {
+
+	tests := []struct{ name, base, ext string }{
+		{"site.zip", "site", ".zip"},
+		{"site", "site", ""},
+		{"site.{yyyy}", "site.{yyyy}", ""},
+		{`v6.0\site`, `v6.0\site`, ""},
+	}
+	for _, tt := range tests {
+		if base, ext := splitExt(tt.name); base != tt.base || ext != tt.ext {
+			t.Errorf("%q: got %q %q, want %q %q", tt.name, base, ext, tt.base, tt.ext)
+		}
+	}
+}
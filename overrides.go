@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+)
+
+// Every setting can be overridden from the environment and the command
+// line. The value is taken from the first of:
+//
+//	--archive-folder flag
+//	EBOBACKUP_ARCHIVEFOLDER environment variable
+//	ArchiveFolder in the config file
+//	the schema default
+
+// envPrefix is the prefix of the environment variables that override settings
+const envPrefix = "EBOBACKUP_"
+
+// settingFlag is a command line flag that overrides a setting
+type settingFlag struct {
+	field *configField
+	value string
+	set   bool
+}
+
+// settingFlags are the setting flags in schema order
+var settingFlags []*settingFlag
+
+func (s *settingFlag) String() string { return s.value }
+
+func (s *settingFlag) Type() string { return s.field.Type.String() }
+
+func (s *settingFlag) Set(value string) error {
+	var c configSettings
+	if err := s.field.set(&c, value); err != nil {
+		return err
+	}
+	s.value = value
+	s.set = true
+	return nil
+}
+
+// flagName is the command line flag for the field, e.g. archive-iso-week
+func (f *configField) flagName() string {
+	r := []rune(f.Name)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) &&
+			(unicode.IsLower(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+			b.WriteByte('-')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// envName is the environment variable for the field, e.g. EBOBACKUP_FTPPASS
+func (f *configField) envName() string {
+	return envPrefix + strings.ToUpper(f.Name)
+}
+
+// addSettingFlags adds a persistent flag for every setting to the command
+func addSettingFlags(cmd *cobra.Command) {
+	for i := range configFields {
+		f := &configFields[i]
+		s := &settingFlag{field: f}
+		settingFlags = append(settingFlags, s)
+
+		flag := cmd.PersistentFlags().VarPF(s, f.flagName(), "", fmt.Sprintf("%s (%s)", f.Desc, f.envName()))
+		if f.Type == fieldBool {
+			flag.NoOptDefVal = "true"
+		}
+	}
+}
+
+// overrideNames returns the environment variables and flags that override
+// settings
+func overrideNames() []string {
+	var names []string
+	for i := range configFields {
+		if _, ok := os.LookupEnv(configFields[i].envName()); ok {
+			names = append(names, configFields[i].envName())
+		}
+	}
+	for _, s := range settingFlags {
+		if s.set {
+			names = append(names, "--"+s.field.flagName())
+		}
+	}
+	return names
+}
+
+// applyOverrides sets the values from the environment and then from the
+// command line flags, so a flag wins over the environment
+func (config *configSettings) applyOverrides() error {
+	if err := config.applyEnv(); err != nil {
+		return err
+	}
+	return config.applyFlags()
+}
+
+// applyEnv sets the values from the environment
+func (config *configSettings) applyEnv() error {
+	for i := range configFields {
+		f := &configFields[i]
+		value, ok := os.LookupEnv(f.envName())
+		if !ok {
+			continue
+		}
+		if err := f.set(config, value); err != nil {
+			return fmt.Errorf("%s: %v", f.envName(), err)
+		}
+		config.setSource(f.Name, valueSource{Kind: "env", Name: f.envName()})
+	}
+	return nil
+}
+
+// applyFlags sets the values given with the command line flags
+func (config *configSettings) applyFlags() error {
+	for _, s := range settingFlags {
+		if !s.set {
+			continue
+		}
+		if err := s.field.set(config, s.value); err != nil {
+			return fmt.Errorf("--%s: %v", s.field.flagName(), err)
+		}
+		config.setSource(s.field.Name, valueSource{Kind: "flag", Name: "--" + s.field.flagName()})
+	}
+	return nil
+}
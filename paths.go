@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Path settings are expanded when the config is loaded:
+//
+//	~\backups                      home folder of the user
+//	%ProgramData%\backups          Windows environment variable
+//	${BACKUP_ROOT}\site            environment variable
+//	{esbackup}                     db_backup folder of the Enterprise Server
+//	{esdb}                         db folder of the Enterprise Server
+//	{esinstall}                    install folder of the Enterprise Server
+//	{esversion}                    EBO version of the Enterprise Server
+//
+// The server tokens use the server found by discovery, see jobServer. Only
+// servers of the job's ServerKind are used: es for an Enterprise Server
+// (the default) or ec for an Enterprise Central.
+//
+// ESBackupPath may also be `auto`, the backup folder of the only server
+// found, or `auto:PATTERN` for the server whose display name matches the
+// pattern, e.g. `auto:*6.0*`. A pattern without wildcards matches a part
+// of the name. The server is looked up on every run, so the folder of a
+// new version is used after an upgrade.
+
+var envPattern = regexp.MustCompile(`%([A-Za-z_][A-Za-z0-9_()]*)%|\$\{([A-Za-z_][A-Za-z0-9_()]*)\}`)
+
+// expandPaths expands every path setting of the job. ESBackupPath is
+// expanded first as the server of the job may be found from it.
+func (config *configSettings) expandPaths() error {
+
+	fields := []*configField{lookupField("ESBackupPath")}
+	for i := range configFields {
+		if f := &configFields[i]; f.Type == fieldPath && f.Name != "ESBackupPath" {
+			fields = append(fields, f)
+		}
+	}
+
+	for _, f := range fields {
+		v := reflect.ValueOf(config).Elem().FieldByName(f.Name)
+		if f.Name == "ESBackupPath" && isAutoPath(v.String()) {
+			path, err := config.autoBackupPath(v.String())
+			if err != nil {
+				return fmt.Errorf("%s: %v", f.Name, err)
+			}
+			v.SetString(path)
+			continue
+		}
+		path, err := config.expandPath(v.String())
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+		v.SetString(path)
+	}
+	return nil
+}
+
+// expandPath expands the home folder, environment variables and server
+// tokens in the path
+func (config *configSettings) expandPath(path string) (string, error) {
+
+	path, err := expandEnv(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !isTemplate(path) {
+		return path, nil
+	}
+	return expandTemplate(path, config.pathToken)
+}
+
+// expandEnv expands the home folder and environment variables in the path
+func expandEnv(path string) (string, error) {
+
+	if path == "~" || strings.HasPrefix(path, `~\`) || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = home + path[1:]
+	}
+
+	var err error
+	path = envPattern.ReplaceAllStringFunc(path, func(s string) string {
+		m := envPattern.FindStringSubmatch(s)
+		name := m[1] + m[2]
+		v, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v
+	})
+	return path, err
+}
+
+// pathToken returns the value of a server token
+func (config *configSettings) pathToken(token string) (string, error) {
+
+	switch token {
+	case "esbackup", "esdb", "esinstall", "esversion":
+	default:
+		return "", fmt.Errorf("unknown token {%s}", token)
+	}
+
+	es, err := config.jobServer()
+	if err != nil {
+		return "", fmt.Errorf("{%s}: %v", token, err)
+	}
+
+	switch token {
+	case "esbackup":
+		return es.DBBackupPath()
+	case "esdb":
+		return es.DBPath()
+	case "esinstall":
+		return es.InstallPath(), nil
+	}
+	if v := eboVersion(es.name); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("{esversion}: no EBO version in `%s`", es.name)
+}
+
+var discoverOnce sync.Once
+var discovered []*eboService
+var discoverErr error
+
+// discoverServers returns the servers found on this computer. discovery
+// runs once and the result is shared by every job.
+func discoverServers() ([]*eboService, error) {
+	discoverOnce.Do(func() {
+		discovered, discoverErr = Servers()
+	})
+	return discovered, discoverErr
+}
+
+// kindServers returns the servers found of the job's ServerKind. finding
+// none is an error, naming the servers of other kinds found.
+func (config *configSettings) kindServers() ([]*eboService, error) {
+
+	kind, err := parseServerKind(config.ServerKind)
+	if err != nil {
+		return nil, fmt.Errorf("ServerKind: %v", err)
+	}
+
+	all, err := discoverServers()
+	if err != nil {
+		return nil, fmt.Errorf("server discovery failed: %v", err)
+	}
+
+	var ess []*eboService
+	for _, es := range all {
+		if es.kind == kind {
+			ess = append(ess, es)
+		}
+	}
+
+	switch {
+	case len(ess) > 0:
+		return ess, nil
+	case len(all) > 0:
+		return nil, fmt.Errorf("no %s found, found %s, set ServerKind to back up another kind", kind.title(), serverNames(all))
+	}
+	return nil, fmt.Errorf("no %s found", kind.title())
+}
+
+// jobServer returns the server the job backs up: the only server of its
+// kind found, or else the server whose backup folder is the job's
+// ESBackupPath
+func (config *configSettings) jobServer() (*eboService, error) {
+
+	ess, err := config.kindServers()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ess) == 1 {
+		return ess[0], nil
+	}
+
+	if config.ESBackupPath != "" && !isTemplate(config.ESBackupPath) {
+		for _, es := range ess {
+			if p, err := es.DBBackupPath(); err == nil && samePath(p, config.ESBackupPath) {
+				return es, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("found %d servers (%s), set ESBackupPath to the backup folder of one", len(ess), serverNames(ess))
+}
+
+// isAutoPath tests if ESBackupPath is `auto` or `auto:PATTERN`
+func isAutoPath(path string) bool {
+	return strings.EqualFold(path, "auto") || len(path) > 5 && strings.EqualFold(path[:5], "auto:")
+}
+
+// autoBackupPath returns the backup folder of the server picked by `auto`
+// or `auto:PATTERN`
+func (config *configSettings) autoBackupPath(value string) (string, error) {
+
+	es, err := config.autoServer(value)
+	if err != nil {
+		return "", err
+	}
+	path, err := es.DBBackupPath()
+	if err != nil {
+		return "", fmt.Errorf("%s: backup folder of `%s` not found: %v", value, es.name, err)
+	}
+	log.Printf("ESBackupPath %s: using the backup folder of `%s`, %s\n", value, es.name, path)
+	return path, nil
+}
+
+// autoServer returns the one server matching the pattern of an `auto`
+// ESBackupPath
+func (config *configSettings) autoServer(value string) (*eboService, error) {
+
+	ess, err := config.kindServers()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", value, err)
+	}
+
+	pattern := strings.TrimSpace(value[min(len(value), 5):])
+	var matches []*eboService
+	for _, es := range ess {
+		if matchName(pattern, es.name) {
+			matches = append(matches, es)
+		}
+	}
+
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("%s: no server matches, found %s", value, serverNames(ess))
+	case len(matches) > 1 && pattern == "":
+		return nil, fmt.Errorf("%s: found %d servers (%s), use auto:PATTERN to pick one", value, len(matches), serverNames(matches))
+	case len(matches) > 1:
+		return nil, fmt.Errorf("%s: %d servers match (%s), use a pattern that matches one", value, len(matches), serverNames(matches))
+	}
+	return matches[0], nil
+}
+
+// matchName matches a display name with a pattern, ignoring case. a
+// pattern without wildcards matches a part of the name.
+func matchName(pattern, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	if !strings.ContainsAny(pattern, "*?[") {
+		return strings.Contains(name, pattern)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// serverNames lists the display names of the servers
+func serverNames(ess []*eboService) string {
+	names := make([]string, len(ess))
+	for i, es := range ess {
+		names[i] = es.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// samePath tests if two paths are the same folder, ignoring case and the
+// kind of slash
+func samePath(a, b string) bool {
+	return strings.EqualFold(filepath.Clean(filepath.FromSlash(a)), filepath.Clean(filepath.FromSlash(b)))
+}
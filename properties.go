@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// readProperties reads a Java .properties file, such as the ES
+// etc\dbpath.properties:
+//
+//	# comment, or a line starting with !
+//	server.paths.db=C:/ProgramData/.../Enterprise Server/db
+//	server.paths.db = C\:\\ProgramData\\...\\db
+//	key: value that \
+//	     continues on the next line
+//
+// keys end at the first unescaped '=', ':' or space, and keys and values
+// may use the escapes \t, \n, \r, \f, \uXXXX and \ before any other
+// character. a key given twice keeps its last value. files that are not
+// UTF-8 are read as ISO 8859-1, as Java does.
+func readProperties(name string) (map[string]string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseProperties(b), nil
+}
+
+// parseProperties returns the keys and values of a .properties file
+func parseProperties(b []byte) map[string]string {
+
+	text := string(b)
+	if !utf8.Valid(b) {
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		text = string(runes)
+	}
+	text = strings.TrimPrefix(text, "\ufeff")
+
+	props := map[string]string{}
+	for _, line := range propertyLines(text) {
+		key, value := splitProperty(line)
+		props[unescapeProperty(key)] = unescapeProperty(value)
+	}
+	return props
+}
+
+// propertyLines joins the continued lines and drops comments and blank
+// lines
+func propertyLines(text string) []string {
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var lines []string
+	var logical strings.Builder
+	continued := false
+	for _, natural := range strings.Split(text, "\n") {
+		natural = strings.TrimLeft(natural, " \t\f")
+		if !continued && (natural == "" || natural[0] == '#' || natural[0] == '!') {
+			continue
+		}
+
+		// an odd number of trailing backslashes continues the line
+		n := len(natural) - len(strings.TrimRight(natural, `\`))
+		continued = n%2 == 1
+		if continued {
+			natural = natural[:len(natural)-1]
+		}
+		logical.WriteString(natural)
+		if !continued {
+			lines = append(lines, logical.String())
+			logical.Reset()
+		}
+	}
+	if logical.Len() > 0 {
+		lines = append(lines, logical.String())
+	}
+	return lines
+}
+
+// splitProperty splits a line into its escaped key and value
+func splitProperty(line string) (string, string) {
+
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+	key, rest := line[:end], line[end:]
+
+	rest = strings.TrimLeft(rest, " \t\f")
+	if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+	return key, rest
+}
+
+// unescapeProperty replaces the escapes in a key or value
+func unescapeProperty(s string) string {
+
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 <= len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					i += 4
+					// characters outside the BMP are written as two escapes
+					if utf16.IsSurrogate(rune(r)) && i+7 <= len(s) && s[i+1:i+3] == `\u` {
+						if r2, err := strconv.ParseUint(s[i+3:i+7], 16, 16); err == nil {
+							b.WriteRune(utf16.DecodeRune(rune(r), rune(r2)))
+							i += 6
+							continue
+						}
+					}
+					b.WriteRune(rune(r))
+					continue
+				}
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
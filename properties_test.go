@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestParseProperties(t *testing.T) {
+
+	file := "\ufeff# comment\r\n" +
+		"! also a comment\r\n" +
+		"server.paths.db=C:/ProgramData/db\r\n" +
+		"   escaped = C\\:\\\\ProgramData\\\\db\r\n" +
+		"colon:value\n" +
+		"space value with spaces\n" +
+		"continued = first, \\\n" +
+		"            second\n" +
+		"backslash = ends with \\\\\n" +
+		"next = 1\n" +
+		"key\\ with\\=escapes = \\t\\u00e9\\ud83d\\ude00\n" +
+		"empty\n" +
+		"dup = 1\n" +
+		"dup = 2\n"
+
+	props := parseProperties([]byte(file))
+	want := map[string]string{
+		"server.paths.db":  "C:/ProgramData/db",
+		"escaped":          `C:\ProgramData\db`,
+		"colon":            "value",
+		"space":            "value with spaces",
+		"continued":        "first, second",
+		"backslash":        `ends with \`,
+		"next":             "1",
+		"key with=escapes": "\té\U0001F600",
+		"empty":            "",
+		"dup":              "2",
+	}
+	for key, value := range want {
+		if got, ok := props[key]; !ok || got != value {
+			t.Errorf("%q: got %q, want %q", key, got, value)
+		}
+	}
+	if len(props) != len(want) {
+		t.Errorf("got %d keys %q, want %d", len(props), props, len(want))
+	}
+}
+
+func TestParsePropertiesLatin1(t *testing.T) {
+
+	// ISO 8859-1 é is not valid UTF-8
+	props := parseProperties([]byte("server.paths.db=C:/Donn\xe9es/db\n"))
+	if got, want := props["server.paths.db"], "C:/Données/db"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The config file may be an https:// URL, so the settings of a fleet can be
+// changed in one place:
+//
+//	ebobackup --config https://config.example.com/ebobackup/site42.config
+//
+// The last good copy is cached next to the exe and the server is asked for
+// it again with If-None-Match and If-Modified-Since. When --config-key is
+// set the file must have an ed25519 signature at the same URL with .sig
+// added. When the server cannot be reached, or the file it returns cannot
+// be used, the cached copy is used and a warning is logged.
+//
+// Includes in a remote config are relative to its URL, and must be https
+// URLs so a signed config cannot pull in a local file that is not signed.
+
+// configKey is the public key remote config files are signed with
+var configKey = os.Getenv(envPrefix + "CONFIG_KEY")
+
+// configCacheDir holds the last good copy of each remote config file
+var configCacheDir = filepath.Join(exeDir, "config-cache")
+
+var configClient = &http.Client{Timeout: 30 * time.Second}
+
+// fetched holds the remote files already read by this run
+var fetched = map[string][]byte{}
+
+// isRemoteConfig tests if the config file is a URL
+func isRemoteConfig(name string) bool {
+	u, err := url.Parse(name)
+	return err == nil && strings.EqualFold(u.Scheme, "https")
+}
+
+// readConfigFile returns the contents of a local or remote config file
+func readConfigFile(name string) ([]byte, error) {
+	if !isRemoteConfig(name) {
+		return os.ReadFile(name)
+	}
+	if file, ok := fetched[name]; ok {
+		return file, nil
+	}
+	file, err := fetchConfig(name)
+	if err == nil {
+		fetched[name] = file
+	}
+	return file, err
+}
+
+// includePath returns the path of a file included by the config file name
+func includePath(name, path string) (string, error) {
+
+	if isRemoteConfig(path) {
+		return path, nil
+	}
+
+	if isRemoteConfig(name) {
+		base, err := url.Parse(name)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(filepath.ToSlash(path))
+		if err != nil {
+			return "", err
+		}
+		// a path such as C:/base.config parses as the scheme c:
+		resolved := base.ResolveReference(ref).String()
+		if !isRemoteConfig(resolved) {
+			return "", fmt.Errorf("%q is not an https URL, a remote config can only include remote files", path)
+		}
+		return resolved, nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(name), path)
+	}
+	return path, nil
+}
+
+// cacheMeta is saved with each cached config file
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Signature    string    `json:"signature,omitempty"` // base64
+}
+
+// configCache is the cached copy of a remote config file
+type configCache struct {
+	file string // cached config
+	meta string // cacheMeta json
+}
+
+func cacheFor(rawURL string) configCache {
+	sum := sha256.Sum256([]byte(rawURL))
+	base := filepath.Join(configCacheDir, hex.EncodeToString(sum[:8]))
+	return configCache{base + ".config", base + ".json"}
+}
+
+// read returns the cached file and its meta data
+func (c configCache) read() ([]byte, *cacheMeta, error) {
+
+	b, err := os.ReadFile(c.meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, nil, fmt.Errorf("cache '%s' is not valid: %v", c.meta, err)
+	}
+
+	file, err := os.ReadFile(c.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, &meta, nil
+}
+
+// write saves the file and its meta data. the file is written first so a
+// failed write never leaves meta data for another file.
+func (c configCache) write(file []byte, meta *cacheMeta) error {
+
+	if err := os.MkdirAll(configCacheDir, 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.file, file); err != nil {
+		return err
+	}
+	return writeFileAtomic(c.meta, b)
+}
+
+// writeFileAtomic replaces the file so readers see the old or the new
+// contents, never a partial file
+func writeFileAtomic(name string, b []byte) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// fetchConfig downloads the remote config file, or returns the cached copy
+// when it has not changed or cannot be downloaded
+func fetchConfig(rawURL string) ([]byte, error) {
+
+	cache := cacheFor(rawURL)
+	cached, meta, cacheErr := cache.read()
+	if cacheErr == nil && configKey != "" {
+		// the cache is checked too, the key may have changed since it was saved
+		if cacheErr = verifyConfig(cached, meta.Signature); cacheErr != nil {
+			cacheErr = fmt.Errorf("cached copy: %v", cacheErr)
+		}
+	}
+	if cacheErr != nil {
+		meta = nil
+	}
+
+	file, newMeta, err := downloadConfig(rawURL, meta)
+	switch {
+	case err == nil && newMeta == nil:
+		// not modified
+		return cached, nil
+
+	case err == nil:
+		if err := cache.write(file, newMeta); err != nil {
+			log.Printf("warning: cannot cache %s: %v\n", rawURL, err)
+		}
+		return file, nil
+
+	case meta != nil:
+		log.Printf("warning: %v, using the copy from %s\n", err, meta.Fetched.Local().Format(time.DateTime))
+		return cached, nil
+	}
+
+	if cacheErr != nil && !errors.Is(cacheErr, os.ErrNotExist) {
+		return nil, fmt.Errorf("%v, %v", err, cacheErr)
+	}
+	return nil, fmt.Errorf("%v, no cached copy", err)
+}
+
+// downloadConfig gets the config file from the server. it returns no file
+// and no meta data when the cached copy described by meta is current.
+func downloadConfig(rawURL string, meta *cacheMeta) ([]byte, *cacheMeta, error) {
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if meta != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := configClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get %s: %v", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && meta != nil:
+		return nil, nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, nil, fmt.Errorf("cannot get %s: %s", rawURL, resp.Status)
+	}
+
+	file, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot get %s: %v", rawURL, err)
+	}
+
+	newMeta := &cacheMeta{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+	}
+
+	if configKey != "" {
+		sig, err := downloadSignature(rawURL + ".sig")
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := verifyConfig(file, sig); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", rawURL, err)
+		}
+		newMeta.Signature = sig
+	}
+
+	if _, err := parseConfigDoc(rawURL, file); err != nil {
+		return nil, nil, err
+	}
+	return file, newMeta, nil
+}
+
+// downloadSignature gets the detached signature of a config file. the
+// signature may be raw or base64.
+func downloadSignature(rawURL string) (string, error) {
+
+	resp, err := configClient.Get(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("cannot get %s: %v", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot get %s: %s", rawURL, resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", fmt.Errorf("cannot get %s: %v", rawURL, err)
+	}
+	if len(b) == ed25519.SignatureSize {
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+	return string(bytes.TrimSpace(b)), nil
+}
+
+// verifyConfig checks the base64 signature of the file with configKey
+func verifyConfig(file []byte, signature string) error {
+
+	key, err := readConfigKey()
+	if err != nil {
+		return err
+	}
+	if signature == "" {
+		return errors.New("not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("signature is not valid")
+	}
+	if !ed25519.Verify(key, file, sig) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+// readConfigKey returns the public key from configKey, which is the base64
+// key or a file that holds it
+func readConfigKey() (ed25519.PublicKey, error) {
+
+	value := configKey
+	if b, err := os.ReadFile(configKey); err == nil {
+		value = string(bytes.TrimSpace(b))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("config key '%s' is not a base64 ed25519 public key", configKey)
+	}
+	return ed25519.PublicKey(key), nil
+}
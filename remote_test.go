@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// configServer serves config files and their signatures over https
+type configServer struct {
+	*httptest.Server
+	files map[string]string // path to contents
+	down  bool              // answer every request with an error
+	gets  int               // full downloads of config files
+}
+
+// newConfigServer starts a server and points the remote config client and
+// cache at it for the test
+func newConfigServer(t *testing.T) *configServer {
+	t.Helper()
+	s := &configServer{files: map[string]string{}}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := s.files[r.URL.Path]
+		switch {
+		case s.down:
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		case !ok:
+			http.NotFound(w, r)
+			return
+		}
+		sum := sha256.Sum256([]byte(file))
+		etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, ".sig") {
+			s.gets++
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(file))
+	}))
+	t.Cleanup(s.Close)
+
+	client, dir, key := configClient, configCacheDir, configKey
+	configClient, configCacheDir, configKey = s.Client(), t.TempDir(), ""
+	t.Cleanup(func() { configClient, configCacheDir, configKey = client, dir, key })
+	s.forget()
+	return s
+}
+
+// forget drops the files read by this run, as a new run would
+func (s *configServer) forget() {
+	fetched = map[string][]byte{}
+}
+
+func TestRemoteConfigCache(t *testing.T) {
+
+	s := newConfigServer(t)
+	s.files["/site.config"] = "ArchiveName = site\n"
+	url := s.URL + "/site.config"
+
+	for run := 1; run <= 2; run++ {
+		s.forget()
+		file, err := readConfigFile(url)
+		if err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		if string(file) != s.files["/site.config"] {
+			t.Errorf("run %d: got %q", run, file)
+		}
+	}
+	if s.gets != 1 {
+		t.Errorf("downloaded %d times, want once and then not modified", s.gets)
+	}
+
+	// a changed file is downloaded again
+	s.files["/site.config"] = "ArchiveName = changed\n"
+	s.forget()
+	if file, err := readConfigFile(url); err != nil || string(file) != s.files["/site.config"] {
+		t.Errorf("changed file: got %q, %v", file, err)
+	}
+
+	// the cached copy is used when the server is down
+	s.down = true
+	s.forget()
+	if file, err := readConfigFile(url); err != nil || string(file) != "ArchiveName = changed\n" {
+		t.Errorf("server down: got %q, %v", file, err)
+	}
+
+	// and there is nothing to fall back on for a file never downloaded
+	s.forget()
+	if _, err := readConfigFile(s.URL + "/other.config"); err == nil || !strings.Contains(err.Error(), "no cached copy") {
+		t.Errorf("no cache: got error %v", err)
+	}
+}
+
+func TestRemoteConfigSignature(t *testing.T) {
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(file string) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte(file)))
+	}
+
+	s := newConfigServer(t)
+	configKey = base64.StdEncoding.EncodeToString(public)
+
+	good := "ArchiveName = site\n"
+	s.files["/site.config"] = good
+	s.files["/site.config.sig"] = sign(good)
+	url := s.URL + "/site.config"
+	if file, err := readConfigFile(url); err != nil || string(file) != good {
+		t.Fatalf("signed file: got %q, %v", file, err)
+	}
+
+	// a file changed without a new signature is refused and the last good
+	// copy is used
+	s.files["/site.config"] = "ArchiveName = evil\n"
+	s.forget()
+	if file, err := readConfigFile(url); err != nil || string(file) != good {
+		t.Errorf("bad signature: got %q, %v, want the cached copy", file, err)
+	}
+
+	s.files["/unsigned.config"] = good
+	s.forget()
+	if _, err := readConfigFile(s.URL + "/unsigned.config"); err == nil {
+		t.Error("unsigned file: no error")
+	}
+
+	s.files["/forged.config"] = "ArchiveName = evil\n"
+	s.files["/forged.config.sig"] = sign(good)
+	s.forget()
+	if _, err := readConfigFile(s.URL + "/forged.config"); err == nil || !strings.Contains(err.Error(), "signature does not match") {
+		t.Errorf("forged file: got error %v", err)
+	}
+
+	// the cache is checked against a new key
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	configKey = base64.StdEncoding.EncodeToString(other)
+	s.down = true
+	s.forget()
+	if _, err := readConfigFile(url); err == nil || !strings.Contains(err.Error(), "cached copy") {
+		t.Errorf("cache with another key: got error %v", err)
+	}
+}
+
+func TestRemoteIncludes(t *testing.T) {
+
+	base := "https://config.example.com/fleet/site42.config"
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"base.config", "https://config.example.com/fleet/base.config"},
+		{"../shared/base.config", "https://config.example.com/shared/base.config"},
+		{"https://other.example.com/base.config", "https://other.example.com/base.config"},
+	}
+	for _, tt := range tests {
+		if got, err := includePath(base, tt.path); err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.path, got, err, tt.want)
+		}
+	}
+
+	for _, path := range []string{`C:\ebobackup\base.config`, "C:/ebobackup/base.config", "file:///etc/base.config", "http://config.example.com/base.config"} {
+		if got, err := includePath(base, path); err == nil {
+			t.Errorf("%q: got %q, want an error", path, got)
+		}
+	}
+
+	s := newConfigServer(t)
+	s.files["/site.config"] = "Include = \"C:\\ebobackup\\local.config\"\n"
+	if _, err := loadConfigDocs(s.URL + "/site.config"); err == nil || !strings.Contains(err.Error(), "not an https URL") {
+		t.Errorf("local include: got error %v", err)
+	}
+}
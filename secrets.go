@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// A secret setting holds either the value itself or a reference to it:
+//
+//	FtpPass = "env:EBO_FTP_PASS"            # environment variable
+//	FtpPass = "file:C:\path\secret.txt"     # first line of a file
+//	FtpPass = "enc:..."                     # encrypted with the local key file
+//
+// References are resolved only when the value is used, so a config with
+// a secret that cannot be read here still loads. Only the reference is
+// ever written back to a config file; a plain value is encrypted first.
+
+// keyFile is the key used for `enc:` secrets, kept next to the exe
+var keyFile = changeExt(filepath.Join(exeDir, exeName), ".key")
+
+// secret is the value of a secret setting
+type secret struct {
+	Ref string // value as written in the config
+}
+
+// String masks the value so it is never printed
+func (s secret) String() string {
+	if s.Ref == "" {
+		return ""
+	}
+	return "********"
+}
+
+// Resolve returns the value of the secret
+func (s secret) Resolve() (string, error) {
+	return resolveSecret(s.Ref)
+}
+
+// IsRef tests if the secret refers to its value rather than holding it
+func (s secret) IsRef() bool {
+	return isSecretRef(s.Ref)
+}
+
+func isSecretRef(s string) bool {
+	for _, p := range []string{"env:", "file:", "enc:"} {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// persist returns the text to save in the config file for the secret
+func (s secret) persist() (string, error) {
+	if s.Ref == "" || s.IsRef() {
+		return s.Ref, nil
+	}
+	return encryptSecret(s.Ref)
+}
+
+// resolveSecret returns the value of a secret reference. values that are
+// not a reference are returned unchanged.
+func resolveSecret(ref string) (string, error) {
+
+	kind, value, _ := strings.Cut(ref, ":")
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(value)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", value)
+		}
+		return v, nil
+
+	case "file":
+		if !filepath.IsAbs(value) {
+			value = filepath.Join(exeDir, value)
+		}
+		b, err := os.ReadFile(value)
+		if err != nil {
+			return "", err
+		}
+		line, _, _ := strings.Cut(string(b), "\n")
+		return strings.TrimSuffix(line, "\r"), nil
+
+	case "enc":
+		return decryptSecret(value)
+	}
+	return ref, nil
+}
+
+// readKey reads the key file, creating a new key if create is set and the
+// file does not exist
+func readKey(create bool) ([]byte, error) {
+
+	b, err := os.ReadFile(keyFile)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("key file '%s' is not valid", keyFile)
+		}
+		return key, nil
+	}
+	if !create || !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	log.Printf("created key file '%s'\n", keyFile)
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret encrypts the value with the key file and returns an
+// `enc:` reference. the key file is created if needed.
+func encryptSecret(value string) (string, error) {
+
+	key, err := readKey(true)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return "enc:" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret decrypts the text of an `enc:` reference
+func decryptSecret(text string) (string, error) {
+
+	key, err := readKey(false)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is not valid")
+	}
+	value, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("encrypted value does not match the key file '%s'", keyFile)
+	}
+	return string(value), nil
+}
+
+var secretPrint bool
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "manage encrypted settings",
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set [key]",
+	Short: "encrypt a secret setting and save it in the configuration file",
+	Long: `Encrypt a secret setting and save it in the configuration file.
+
+	the value is read from the input and encrypted with the key file next
+	to the exe, which is created if needed. the key defaults to FtpPass.
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		name := "FtpPass"
+		if len(args) > 0 {
+			name = args[0]
+		}
+		f := lookupField(name)
+		if f == nil || f.Type != fieldSecret {
+			log.Fatalf("%s is not a secret setting", name)
+		}
+
+		fmt.Printf("%s: ", f.Name)
+		value, err := readSecretValue()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ref, err := encryptSecret(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if secretPrint {
+			fmt.Println(ref)
+			return
+		}
+
+		file, err := getConfigFile()
+		if err != nil {
+			log.Fatalf("config file '%s' not found, use --print to show the value to add", file)
+		}
+		if err := setConfigValue(file, f, ref); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("saved %s in %s\n", f.Name, file)
+	},
+}
+
+// readSecretValue reads a line from the input, without echo when it is a
+// terminal
+func readSecretValue() (string, error) {
+
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Println()
+		return string(b), err
+	}
+
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	value = strings.TrimRight(value, "\r\n")
+	if err != nil && value == "" {
+		return "", err
+	}
+	return value, nil
+}
+
+// setConfigValue sets a key in the config file, in the section of the
+// job selected with --job or else at the top of the file
+func setConfigValue(file string, f *configField, value string) error {
+
+	if isRemoteConfig(file) {
+		return fmt.Errorf("%s is a remote config, use --print and add the value on the server", file)
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	doc, err := parseConfigDoc(file, b)
+	if err != nil {
+		return err
+	}
+
+	// a value at the top of the file has no effect on a job that sets its
+	// own
+	if selectedJob == "" {
+		var jobs []string
+		for _, line := range doc.Lines {
+			if len(line.Section) == 2 && strings.EqualFold(line.Section[0], "job") && strings.EqualFold(line.Key, f.Name) {
+				jobs = append(jobs, fmt.Sprintf("`%s`", line.Section[1]))
+			}
+		}
+		if len(jobs) > 0 {
+			return fmt.Errorf("%s is set in job %s, which would not use the new value. use --job to save it there", f.Name, strings.Join(jobs, ", "))
+		}
+	}
+
+	// the line to change, or the line to add the key after
+	var target *configLine
+	after := -1
+	inSection := selectedJob == ""
+	for i, line := range doc.Lines {
+		if line.Header {
+			if inSection && after >= 0 {
+				break
+			}
+			inSection = selectedJob != "" && len(line.Section) == 2 &&
+				strings.EqualFold(line.Section[0], "job") && strings.EqualFold(line.Section[1], selectedJob)
+			if inSection {
+				after = i
+			}
+			continue
+		}
+		if !inSection || line.Key == "" {
+			continue
+		}
+		after = i
+		if strings.EqualFold(line.Key, f.Name) {
+			target = line
+		}
+	}
+
+	switch {
+	case target != nil:
+		target.setValue(formatConfigValue(f, value))
+	case after >= 0 || selectedJob == "":
+		doc.insert(after+1, formatConfigLine(f, value))
+	default:
+		return fmt.Errorf("job %q not found in %s", selectedJob, file)
+	}
+
+	if _, _, err := parseConfig(file, doc.Bytes()); err != nil {
+		return err
+	}
+	return os.WriteFile(file, doc.Bytes(), 0o644)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetConfigValue(t *testing.T) {
+
+	dir := writeConfigFiles(t, map[string]string{
+		"site.config": "FtpPass = \"a\"\n[job.a]\nFtpPass = \"b\"\n[job.b]\nBackupFolder = /b\n",
+	})
+	name := filepath.Join(dir, "site.config")
+	f := lookupField("FtpPass")
+
+	// the top of the file is not used by job a
+	selectJob(t, "")
+	if err := setConfigValue(name, f, "env:NEW"); err == nil || !strings.Contains(err.Error(), "job `a`") {
+		t.Errorf("got error %v, want job a", err)
+	}
+
+	selectJob(t, "b")
+	if err := setConfigValue(name, f, "env:NEW"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "FtpPass = \"a\"\n[job.a]\nFtpPass = \"b\"\n[job.b]\nBackupFolder = /b\n"
+	if got := string(b); !strings.HasPrefix(got, want) || !strings.Contains(got[len(want):], `FtpPass`) {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestSecretResolvedWhenUsed(t *testing.T) {
+
+	jobs, _, err := parseConfig("test.config", []byte(`FtpPass = "env:EBOBACKUP_TEST_UNSET"`))
+	if err != nil {
+		t.Fatalf("an unresolved secret failed the config: %v", err)
+	}
+	if _, err := jobs[0].FtpPass.Resolve(); err == nil {
+		t.Error("no error resolving an unset variable")
+	}
+
+	t.Setenv("EBOBACKUP_TEST_UNSET", "pw")
+	if v, err := jobs[0].FtpPass.Resolve(); err != nil || v != "pw" {
+		t.Errorf("got %q, %v", v, err)
+	}
+}
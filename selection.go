@@ -0,0 +1,476 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The backups collected from each folder of ESBackupPath are chosen by the
+// selection settings of the job, which a [server.NAME] section may change
+// for one server:
+//
+//	BackupCount     = 3               # the newest 3, 0 for no limit
+//	BackupNewerThan = "14d"           # only backups newer than 14 days
+//	BackupInclude   = "*_weekly*"     # only names matching a pattern
+//	BackupExclude   = "*_test*, tmp*" # not names matching a pattern
+//
+// Patterns match the file name and are not case sensitive. The default
+// keeps the newest backup of each folder.
+//
+// BackupTime keeps, for each day, only the backup taken nearest to a time
+// of day, so a scheduled backup is collected rather than one taken by hand
+// later that day:
+//
+//	BackupTime          = "02:00"
+//	BackupTimeTolerance = "1h"                # not backups taken after 03:00
+//	BackupTimeFormat    = "yyyyMMdd_HHmmss"   # time in the name, else modified
+//
+// The count and age limits then apply to the backups kept.
+
+// selectionPolicy chooses the backups collected from a folder
+type selectionPolicy struct {
+	Count   int
+	MaxAge  time.Duration
+	Include []string
+	Exclude []string
+
+	// Scheduled keeps the backup nearest to Time, the time of day, within
+	// Tolerance. Format finds the time in the file name.
+	Scheduled bool
+	Time      time.Duration
+	Tolerance time.Duration
+	Format    *nameTime
+}
+
+// isDefault tests if the policy keeps only the newest backup
+func (p selectionPolicy) isDefault() bool {
+	return p.Count == 1 && p.MaxAge == 0 && len(p.Include) == 0 && len(p.Exclude) == 0 && !p.Scheduled
+}
+
+// selection is a backup found with the reason it was or was not picked
+type selection struct {
+	Path   string
+	Server string
+	Picked bool
+	Reason string
+}
+
+// policy returns the selection policy of the server: the job settings
+// changed by those set in the server section
+func (config *configSettings) policy(server *serverSettings) (selectionPolicy, error) {
+
+	value := func(name string) reflect.Value {
+		if server != nil && server.isSet(name) {
+			return reflect.ValueOf(server).Elem().FieldByName(name)
+		}
+		return reflect.ValueOf(config).Elem().FieldByName(name)
+	}
+	count := int(value("BackupCount").Int())
+	newerThan := value("BackupNewerThan").String()
+	include := value("BackupInclude").String()
+	exclude := value("BackupExclude").String()
+	at := value("BackupTime").String()
+	tolerance := value("BackupTimeTolerance").String()
+	format := value("BackupTimeFormat").String()
+
+	// every setting is checked so validate can report all of them
+	var errs []error
+	p := selectionPolicy{Count: count}
+	if count < 0 {
+		errs = append(errs, fmt.Errorf("BackupCount: %d is negative, use 0 for no limit", count))
+	}
+
+	var err error
+	if p.MaxAge, err = parseAge(newerThan); err != nil {
+		errs = append(errs, fmt.Errorf("BackupNewerThan: %v", err))
+	}
+	if p.Include, err = parsePatterns(include); err != nil {
+		errs = append(errs, fmt.Errorf("BackupInclude: %v", err))
+	}
+	if p.Exclude, err = parsePatterns(exclude); err != nil {
+		errs = append(errs, fmt.Errorf("BackupExclude: %v", err))
+	}
+	if p.Time, p.Scheduled, err = parseTimeOfDay(at); err != nil {
+		errs = append(errs, fmt.Errorf("BackupTime: %v", err))
+	}
+	if p.Tolerance, err = parseAge(tolerance); err != nil {
+		errs = append(errs, fmt.Errorf("BackupTimeTolerance: %v", err))
+	}
+	if p.Format, err = parseNameTime(format); err != nil {
+		errs = append(errs, fmt.Errorf("BackupTimeFormat: %v", err))
+	}
+	return p, errors.Join(errs...)
+}
+
+// parseAge parses a duration such as 36h, 14d or 2w. an empty age is no
+// limit.
+func parseAge(s string) (time.Duration, error) {
+
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil || f < 0 {
+				return 0, fmt.Errorf("%q is not an age such as 36h, 14d or 2w", s)
+			}
+			return time.Duration(f * float64(unit)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%q is not an age such as 36h, 14d or 2w", s)
+	}
+	return d, nil
+}
+
+// parsePatterns splits a comma separated list of file name patterns
+func parsePatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("%q is not a valid pattern", p)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// matchPattern returns the first pattern matching the file name
+func matchPattern(patterns []string, file string) (string, bool) {
+	name := strings.ToLower(filepath.Base(file))
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// pick applies the policy to the backups of a folder
+func (p selectionPolicy) pick(backups []backupFile, now time.Time) []selection {
+
+	// the time of a backup is in its name with BackupTimeFormat
+	times := map[string]time.Time{}
+	for _, b := range backups {
+		times[b.Path] = b.ModTime
+		if p.Format != nil {
+			t, _ := p.Format.parse(filepath.Base(b.Path))
+			times[b.Path] = t
+		}
+	}
+	backups = append([]backupFile{}, backups...)
+	sort.SliceStable(backups, func(i, j int) bool { return times[backups[i].Path].After(times[backups[j].Path]) })
+
+	list := make([]selection, len(backups))
+	for i, b := range backups {
+		list[i] = selection{Path: b.Path, Reason: p.reject(b.Path, times[b.Path], now)}
+	}
+	if p.Scheduled {
+		p.keepNearest(list, times)
+	}
+
+	picked := 0
+	for i := range list {
+		s := &list[i]
+		switch {
+		case s.Reason != "":
+		case p.Count > 0 && picked >= p.Count:
+			s.Reason = fmt.Sprintf("not among the newest %d", p.Count)
+		default:
+			picked++
+			s.Picked = true
+			s.Reason = p.reason(picked)
+		}
+	}
+	return list
+}
+
+// reject returns why the backup is not collected, or an empty string
+func (p selectionPolicy) reject(file string, t, now time.Time) string {
+
+	if _, ok := matchPattern(p.Include, file); len(p.Include) > 0 && !ok {
+		return "not matched by BackupInclude"
+	}
+	if pattern, ok := matchPattern(p.Exclude, file); ok {
+		return fmt.Sprintf("excluded by %q", pattern)
+	}
+	if t.IsZero() {
+		return fmt.Sprintf("no time %s in the name", p.Format)
+	}
+	if p.MaxAge > 0 && now.Sub(t) > p.MaxAge {
+		return fmt.Sprintf("older than %s", formatAge(p.MaxAge))
+	}
+	if p.Scheduled {
+		if _, off := p.scheduled(t); off > p.Tolerance {
+			return fmt.Sprintf("taken at %s, more than %s from %s", t.Format("15:04"), formatAge(p.Tolerance), formatTimeOfDay(p.Time))
+		}
+	}
+	return ""
+}
+
+// scheduled returns the scheduled time nearest to t, which may be on the
+// day before or after, and how far t is from it
+func (p selectionPolicy) scheduled(t time.Time) (time.Time, time.Duration) {
+	y, m, d := t.Date()
+	at := time.Date(y, m, d, 0, 0, 0, 0, t.Location()).Add(p.Time)
+	switch diff := t.Sub(at); {
+	case diff > 12*time.Hour:
+		at = at.AddDate(0, 0, 1)
+	case diff < -12*time.Hour:
+		at = at.AddDate(0, 0, -1)
+	}
+	off := t.Sub(at)
+	if off < 0 {
+		off = -off
+	}
+	return at, off
+}
+
+// keepNearest skips every backup of a day but the one nearest to the
+// scheduled time
+func (p selectionPolicy) keepNearest(list []selection, times map[string]time.Time) {
+
+	nearest := map[time.Time]int{}
+	for i, s := range list {
+		if s.Reason != "" {
+			continue
+		}
+		at, off := p.scheduled(times[s.Path])
+		if j, ok := nearest[at]; ok {
+			if _, best := p.scheduled(times[list[j].Path]); best <= off {
+				continue
+			}
+		}
+		nearest[at] = i
+	}
+
+	for i := range list {
+		s := &list[i]
+		if s.Reason != "" {
+			continue
+		}
+		if at, _ := p.scheduled(times[s.Path]); nearest[at] != i {
+			s.Reason = fmt.Sprintf("not the nearest to %s on %s", formatTimeOfDay(p.Time), at.Format("2006-01-02"))
+		}
+	}
+}
+
+// reason describes why the nth backup picked was picked
+func (p selectionPolicy) reason(n int) string {
+	var parts []string
+	if p.Count > 0 {
+		parts = append(parts, fmt.Sprintf("newest %d of %d", n, p.Count))
+	}
+	if p.MaxAge > 0 {
+		parts = append(parts, fmt.Sprintf("newer than %s", formatAge(p.MaxAge)))
+	}
+	if len(p.Include) > 0 {
+		parts = append(parts, "matched by BackupInclude")
+	}
+	if p.Scheduled {
+		parts = append(parts, fmt.Sprintf("nearest to %s", formatTimeOfDay(p.Time)))
+	}
+	if len(parts) == 0 {
+		return "no limit"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatAge formats an age in whole days or hours when it is one
+func formatAge(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return d.String()
+}
+
+// parseTimeOfDay parses a time of day such as 02:00 or 23:30:00. an empty
+// time is not set.
+func parseTimeOfDay(s string) (time.Duration, bool, error) {
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false, nil
+	}
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())), true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("%q is not a time of day such as 02:00", s)
+}
+
+// formatTimeOfDay formats a time of day as 15:04
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", d/time.Hour, d%time.Hour/time.Minute)
+}
+
+// nameTime finds the time in a file name with a format such as
+// yyyyMMdd_HHmmss, where yyyy, MM, dd, HH, mm and ss are the parts of the
+// time and every other character matches itself
+type nameTime struct {
+	format string
+	re     *regexp.Regexp
+	parts  []string
+}
+
+func (n *nameTime) String() string {
+	return n.format
+}
+
+// nameTimeParts are the parts of a BackupTimeFormat
+var nameTimeParts = []string{"yyyy", "MM", "dd", "HH", "mm", "ss"}
+
+// parseNameTime parses a BackupTimeFormat. an empty format is not set.
+func parseNameTime(format string) (*nameTime, error) {
+
+	if strings.TrimSpace(format) == "" {
+		return nil, nil
+	}
+
+	n := &nameTime{format: format}
+	var expr strings.Builder
+	for rest := format; rest != ""; {
+		part := ""
+		for _, p := range nameTimeParts {
+			if strings.HasPrefix(rest, p) {
+				part = p
+				break
+			}
+		}
+		if part == "" {
+			expr.WriteString(regexp.QuoteMeta(rest[:1]))
+			rest = rest[1:]
+			continue
+		}
+		if slices.Contains(n.parts, part) {
+			return nil, fmt.Errorf("%q has %s twice", format, part)
+		}
+		n.parts = append(n.parts, part)
+		fmt.Fprintf(&expr, `(\d{%d})`, len(part))
+		rest = rest[len(part):]
+	}
+	for _, p := range []string{"yyyy", "MM", "dd"} {
+		if !slices.Contains(n.parts, p) {
+			return nil, fmt.Errorf("%q has no %s, use yyyy, MM, dd, HH, mm and ss", format, p)
+		}
+	}
+	n.re = regexp.MustCompile(expr.String())
+	return n, nil
+}
+
+// parse returns the local time found in the file name
+func (n *nameTime) parse(name string) (time.Time, bool) {
+
+	m := n.re.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	v := map[string]int{}
+	for i, p := range n.parts {
+		v[p], _ = strconv.Atoi(m[i+1])
+	}
+	t := time.Date(v["yyyy"], time.Month(v["MM"]), v["dd"], v["HH"], v["mm"], v["ss"], 0, time.Local)
+	if t.Month() != time.Month(v["MM"]) || t.Day() != v["dd"] || v["HH"] > 23 || v["mm"] > 59 || v["ss"] > 59 {
+		return time.Time{}, false // not a valid time, e.g. 20240231
+	}
+	return t, true
+}
+
+// explainBackups prints every backup found with the reason it is or is
+// not collected
+func (config *configSettings) explainBackups() error {
+
+	list, err := config.selectBackups()
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		status := "skip"
+		if s.Picked {
+			status = "collect"
+		}
+		fmt.Printf("%-7s  %s  # %s\n", status, s.Path, s.Reason)
+	}
+	return nil
+}
+
+// backupFile is a backup found in ESBackupPath
+type backupFile struct {
+	Path    string
+	ModTime time.Time
+}
+
+// selectBackups applies the selection policy of each server to the
+// backups in ESBackupPath. every backup found is returned with the reason
+// it was or was not picked.
+func (config *configSettings) selectBackups() ([]selection, error) {
+
+	var dirs []string
+	backups := map[string][]backupFile{}
+	err := filepath.Walk(config.ESBackupPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if IsFileXBK(path) {
+			dir := filepath.Dir(path)
+			if _, ok := backups[dir]; !ok {
+				dirs = append(dirs, dir)
+			}
+			backups[dir] = append(backups[dir], backupFile{path, info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var list []selection
+	for _, dir := range dirs {
+		server := config.server(config.serverOf(dir))
+		files := backups[dir]
+
+		if server.Skip {
+			for _, b := range files {
+				list = append(list, selection{Path: b.Path, Server: server.Name, Reason: "server is skipped"})
+			}
+			continue
+		}
+
+		p, err := config.policy(server)
+		if err != nil {
+			if server.Name != "" {
+				return nil, fmt.Errorf("server `%s`: %v", server.Name, err)
+			}
+			return nil, err
+		}
+		for _, s := range p.pick(files, now) {
+			s.Server = server.Name
+			list = append(list, s)
+		}
+	}
+	return list, nil
+}
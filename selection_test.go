@@ -0,0 +1,246 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// day is a local time in March 2024
+func day(d, h, m int) time.Time {
+	return time.Date(2024, 3, d, h, m, 0, 0, time.Local)
+}
+
+// picked returns the names picked from the list
+func picked(list []selection) []string {
+	var names []string
+	for _, s := range list {
+		if s.Picked {
+			names = append(names, s.Path)
+		}
+	}
+	return names
+}
+
+func TestParseAge(t *testing.T) {
+
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"36h", 36 * time.Hour},
+		{"14d", 14 * 24 * time.Hour},
+		{"2W", 14 * 24 * time.Hour},
+		{"1.5d", 36 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got, err := parseAge(tt.s); err != nil || got != tt.want {
+			t.Errorf("%q: got %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"14", "-1d", "d", "2 weeks"} {
+		if _, err := parseAge(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+
+	now := day(10, 12, 0)
+	backups := []backupFile{
+		{"es_test.xbk", day(10, 2, 0)},
+		{"es_daily_3.xbk", day(9, 2, 0)},
+		{"es_weekly_1.xbk", day(8, 2, 0)},
+		{"es_daily_1.xbk", day(7, 2, 0)},
+		{"es_weekly_0.xbk", day(1, 2, 0)},
+	}
+
+	tests := []struct {
+		name   string
+		policy selectionPolicy
+		want   string
+	}{
+		{"default", selectionPolicy{Count: 1}, "es_test.xbk"},
+		{"no limit", selectionPolicy{}, "es_test.xbk es_daily_3.xbk es_weekly_1.xbk es_daily_1.xbk es_weekly_0.xbk"},
+		{"count", selectionPolicy{Count: 2, Exclude: []string{"*_test*"}}, "es_daily_3.xbk es_weekly_1.xbk"},
+		{"age", selectionPolicy{MaxAge: 3 * 24 * time.Hour}, "es_test.xbk es_daily_3.xbk es_weekly_1.xbk"},
+		{"include", selectionPolicy{Include: []string{"*_weekly*"}}, "es_weekly_1.xbk es_weekly_0.xbk"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(picked(tt.policy.pick(backups, now)), " "); got != tt.want {
+			t.Errorf("%s: picked %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	p := selectionPolicy{Count: 1, MaxAge: 3 * 24 * time.Hour, Include: []string{"es_*"}, Exclude: []string{"*_test*"}}
+	reasons := map[string]string{}
+	for _, s := range p.pick(backups, now) {
+		reasons[s.Path] = s.Reason
+	}
+	want := map[string]string{
+		"es_test.xbk":     `excluded by "*_test*"`,
+		"es_daily_3.xbk":  "newest 1 of 1, newer than 3d, matched by BackupInclude",
+		"es_weekly_1.xbk": "not among the newest 1",
+		"es_daily_1.xbk":  "older than 3d",
+	}
+	for name, reason := range want {
+		if reasons[name] != reason {
+			t.Errorf("%s: reason %q, want %q", name, reasons[name], reason)
+		}
+	}
+}
+
+func TestPickScheduled(t *testing.T) {
+
+	format, err := parseNameTime("yyyyMMdd_HHmm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := selectionPolicy{Scheduled: true, Time: 2 * time.Hour, Tolerance: time.Hour, Format: format}
+
+	// modified times differ from the names, which are used
+	modified := day(10, 12, 0)
+	backups := []backupFile{
+		{"es_20240310_1530.xbk", modified}, // by hand, too far from 02:00
+		{"es_20240310_0205.xbk", modified},
+		{"es_20240310_0150.xbk", modified},
+		{"es_20240309_0230.xbk", modified},
+		{"es_20240309_0150.xbk", modified}, // nearer than 02:30
+		{"es_20240308_0010.xbk", modified}, // more than an hour early
+		{"es_20240231_0200.xbk", modified}, // not a date
+		{"es_manual.xbk", modified},
+	}
+
+	reasons := map[string]string{}
+	for _, s := range p.pick(backups, day(10, 12, 0)) {
+		reasons[s.Path] = s.Reason
+	}
+	want := map[string]string{
+		"es_20240310_1530.xbk": "taken at 15:30, more than 1h from 02:00",
+		"es_20240310_0205.xbk": "nearest to 02:00",
+		"es_20240310_0150.xbk": "not the nearest to 02:00 on 2024-03-10",
+		"es_20240309_0230.xbk": "not the nearest to 02:00 on 2024-03-09",
+		"es_20240309_0150.xbk": "nearest to 02:00",
+		"es_20240308_0010.xbk": "taken at 00:10, more than 1h from 02:00",
+		"es_20240231_0200.xbk": "no time yyyyMMdd_HHmm in the name",
+		"es_manual.xbk":        "no time yyyyMMdd_HHmm in the name",
+	}
+	for name, reason := range want {
+		if reasons[name] != reason {
+			t.Errorf("%s: reason %q, want %q", name, reasons[name], reason)
+		}
+	}
+}
+
+func TestScheduledAcrossMidnight(t *testing.T) {
+
+	p := selectionPolicy{Scheduled: true, Time: 23*time.Hour + 30*time.Minute}
+	at, off := p.scheduled(day(11, 0, 15))
+	if !at.Equal(day(10, 23, 30)) || off != 45*time.Minute {
+		t.Errorf("got %v off by %v, want 23:30 the day before off by 45m", at, off)
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+
+	if d, ok, err := parseTimeOfDay("02:30"); err != nil || !ok || d != 2*time.Hour+30*time.Minute {
+		t.Errorf("02:30: got %v, %v, %v", d, ok, err)
+	}
+	if d, ok, err := parseTimeOfDay("23:00:30"); err != nil || !ok || d != 23*time.Hour+30*time.Second {
+		t.Errorf("23:00:30: got %v, %v, %v", d, ok, err)
+	}
+	if _, ok, err := parseTimeOfDay(" "); err != nil || ok {
+		t.Errorf("empty: got %v, %v", ok, err)
+	}
+	for _, s := range []string{"2am", "24:00", "2:00:00:00"} {
+		if _, _, err := parseTimeOfDay(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+func TestParseNameTime(t *testing.T) {
+
+	n, err := parseNameTime("backup_ddMMyyyy-HH.mm.ss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := n.parse("es_backup_31122023-23.59.01.xbk")
+	if want := time.Date(2023, 12, 31, 23, 59, 1, 0, time.Local); !ok || !got.Equal(want) {
+		t.Errorf("got %v, %v, want %v", got, ok, want)
+	}
+	if _, ok := n.parse("es_backup_31122023-23x59x01.xbk"); ok {
+		t.Error("the dots of the format matched any character")
+	}
+
+	tests := []struct{ format, want string }{
+		{"MMdd_HHmm", "has no yyyy"},
+		{"yyyyMMdd_dd", "has dd twice"},
+	}
+	for _, tt := range tests {
+		if _, err := parseNameTime(tt.format); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: got error %v, want %q", tt.format, err, tt.want)
+		}
+	}
+}
+
+func TestServerPolicy(t *testing.T) {
+
+	file := strings.Join([]string{
+		`BackupCount     = 3`,
+		`BackupExclude   = "*_test*"`,
+		`BackupTime      = "02:00"`,
+		`[server."ES-Main"]`,
+		`BackupCount     = 0`,
+		`BackupNewerThan = "7d"`,
+		`[server."AS-1"]`,
+		`BackupTime      = "bad"`,
+	}, "\n")
+	jobs, _, err := parseConfig("test.config", []byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := jobs[0]
+
+	p, err := config.policy(config.server("ES-Main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Count != 0 || p.MaxAge != 7*24*time.Hour || len(p.Exclude) != 1 || !p.Scheduled {
+		t.Errorf("ES-Main: got %+v, want the server count and age with the job exclude and time", p)
+	}
+
+	if p, err := config.policy(config.server("other")); err != nil || p.Count != 3 || p.MaxAge != 0 {
+		t.Errorf("server without a section: got %+v, %v", p, err)
+	}
+
+	if _, err := config.policy(config.server("AS-1")); err == nil || !strings.Contains(err.Error(), "BackupTime:") {
+		t.Errorf("AS-1: got error %v, want BackupTime", err)
+	}
+}
+
+func TestValidateEveryBackup(t *testing.T) {
+
+	tests := []struct {
+		file     string
+		warnings int
+	}{
+		{"BackupCount = 0\n", 1},
+		{"BackupCount = 0\nBackupNewerThan = 14d\n", 0},
+		{"BackupCount = 0\nBackupTime = 02:00\n", 0},
+	}
+	for _, tt := range tests {
+		jobs, _, err := parseConfig("test.config", []byte(tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v validation
+		validatePolicy(jobs[0], nil, "", &v)
+		if v.warnings != tt.warnings {
+			t.Errorf("%q: got warnings %q, want %d", tt.file, v.lines, tt.warnings)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// ESBackupPath has a folder for each server: the Enterprise Server and each
+// Automation Server. A server folder can be given its own settings, and
+// its own backup selection, see selectionPolicy:
+//
+//	[server."AS-Boiler"]            # every job
+//	Skip         = true
+//
+//	[job.site.server."ES-Main"]     # only the site job
+//	BackupCount  = 3
+//	FriendlyName = "Main ES"
+//
+// The settings of a job override those for every job. Servers without
+// settings use the selection settings of the job.
+
+// serverSettings are the settings of a server folder in ESBackupPath
+type serverSettings struct {
+	Name string // folder name
+
+	Skip                bool
+	BackupCount         int
+	BackupNewerThan     string
+	BackupInclude       string
+	BackupExclude       string
+	BackupTime          string
+	BackupTimeTolerance string
+	BackupTimeFormat    string
+	MaxBackupAge        string
+	FriendlyName        string
+
+	// sources records where each setting was taken from
+	sources map[string]valueSource
+}
+
+func (s *serverSettings) setSource(name string, src valueSource) {
+	if s.sources == nil {
+		s.sources = map[string]valueSource{}
+	}
+	s.sources[name] = src
+}
+
+// isSet tests if the setting is set in a server section
+func (s *serverSettings) isSet(name string) bool {
+	_, ok := s.sources[name]
+	return ok
+}
+
+// source returns where the setting was taken from
+func (s *serverSettings) source(name string) valueSource {
+	if src, ok := s.sources[name]; ok {
+		return src
+	}
+	return valueSource{Kind: "default"}
+}
+
+// serverFields is the schema of a server section. the selection settings
+// default to those of the job, see policy.
+var serverFields = []configField{
+	{"Skip", fieldBool, "false", "do not collect the backups of the server"},
+	{"BackupCount", fieldInt, "1", "number of the newest backups of the server to collect, 0 for no limit"},
+	{"BackupNewerThan", fieldString, "", "only collect backups newer than this, e.g. 36h, 14d or 2w"},
+	{"BackupInclude", fieldString, "", "only collect backups whose names match one of these comma separated patterns"},
+	{"BackupExclude", fieldString, "", "do not collect backups whose names match one of these comma separated patterns"},
+	{"BackupTime", fieldString, "", "for each day only collect the backup taken nearest to this time of day, e.g. 02:00"},
+	{"BackupTimeTolerance", fieldString, "1h", "do not collect backups taken further than this from BackupTime"},
+	{"BackupTimeFormat", fieldString, "", "time in the backup names used by BackupTime, e.g. yyyyMMdd_HHmmss, the modification time if empty"},
+	{"MaxBackupAge", fieldString, "", "report the server as stale when its newest backup is older than this, e.g. 8d"},
+	{"FriendlyName", fieldString, "", "folder of the server backups in the archive"},
+}
+
+// defaultServer returns the settings of a server without a section
+func defaultServer(name string) *serverSettings {
+	s := &serverSettings{Name: name}
+	for i := range serverFields {
+		f := &serverFields[i]
+		if err := f.set(s, f.Default); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+// server returns the settings of the server folder. names are not case
+// sensitive.
+func (config *configSettings) server(name string) *serverSettings {
+	for _, s := range config.servers {
+		if strings.EqualFold(s.Name, name) {
+			return s
+		}
+	}
+	return defaultServer(name)
+}
+
+// serverOf returns the server of a folder in ESBackupPath, or an empty
+// string for ESBackupPath itself
+func (config *configSettings) serverOf(dir string) string {
+	rel, err := filepath.Rel(config.ESBackupPath, dir)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	first, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return first
+}
+
+// getSelectedBackupFiles gets the backups picked by the selection policy
+// of each server
+func (config *configSettings) getSelectedBackupFiles() ([]string, error) {
+
+	list, err := config.selectBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	skipped := map[string]bool{}
+	for _, s := range list {
+		switch {
+		case s.Picked:
+			files = append(files, s.Path)
+		case s.Reason == "server is skipped" && !skipped[s.Server]:
+			log.Printf("skipping server `%s`\n", s.Server)
+			skipped[s.Server] = true
+		}
+	}
+	return files, nil
+}
+
+// archiveEntry returns the name of a backup in the archive, in the folder
+// of its server's FriendlyName if it has one
+func (config *configSettings) archiveEntry(file string) string {
+	name := config.backupTarget(file)
+	if server := config.server(config.serverOf(filepath.Dir(file))); server.FriendlyName != "" {
+		if _, rest, ok := strings.Cut(name, "/"); ok {
+			name = rest // the server folder
+		}
+		return server.FriendlyName + "/" + name
+	}
+	return name
+}
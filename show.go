@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/spf13/cobra"
+)
+
+var showEffective bool
+var showJSON bool
+
+var showCmd = &cobra.Command{
+	Use:   "show",
+	Short: "print the configuration file",
+	Long: `Print the configuration file with plain text passwords masked.
+
+	with --effective the settings each job runs with are printed after
+	applying defaults, environment variables and flags, with where each
+	value was taken from. secrets are masked.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := getConfigFile()
+		if err != nil {
+			log.Printf("Error config file '%s' not found!\n", file)
+			cmd.Usage()
+			return
+		}
+
+		if !showEffective {
+			b, err := readConfigFile(file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			doc, err := parseConfigDoc(file, b)
+			if err != nil {
+				log.Fatal(err)
+			}
+			maskSecrets(doc)
+			os.Stdout.Write(doc.Bytes())
+			return
+		}
+
+		jobs, warnings, err := readConfig(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		picked := "default"
+		if cmd.Flags().Changed("config") {
+			picked = "--config"
+		}
+		if !isRemoteConfig(file) {
+			if abs, err := filepath.Abs(file); err == nil {
+				file = abs
+			}
+		}
+
+		report := effectiveConfig{File: file, Picked: picked}
+		docs, _ := loadConfigDocs(file)
+		for _, doc := range docs[:max(len(docs)-1, 0)] {
+			report.Includes = append(report.Includes, doc.Name)
+		}
+		for _, w := range warnings {
+			report.Warnings = append(report.Warnings, w.Error())
+		}
+		for _, job := range jobs {
+			report.Jobs = append(report.Jobs, job.effective())
+		}
+
+		if showJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		report.print()
+	},
+}
+
+// maskSecrets masks the plain text values of secret keys. references such
+// as env:NAME are kept, they do not reveal the value.
+func maskSecrets(doc *configDoc) {
+	for _, line := range doc.Lines {
+		if line.Key == "" {
+			continue
+		}
+		f := findField(sectionFields(line.Section), line.Key)
+		if f != nil && f.Type == fieldSecret && line.Value != "" && !isSecretRef(line.Value) {
+			line.setValue(`"********"`)
+		}
+	}
+}
+
+// effectiveConfig is the resolved configuration of every job
+type effectiveConfig struct {
+	File     string         `json:"file"`
+	Picked   string         `json:"picked"`
+	Includes []string       `json:"includes,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+	Jobs     []effectiveJob `json:"jobs"`
+}
+
+type effectiveJob struct {
+	Name     string             `json:"name"`
+	Settings []effectiveSetting `json:"settings"`
+	Servers  []effectiveServer  `json:"servers,omitempty"`
+}
+
+type effectiveServer struct {
+	Name     string             `json:"name"`
+	Settings []effectiveSetting `json:"settings"`
+}
+
+type effectiveSetting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// effective returns the settings of the job with their sources
+func (config *configSettings) effective() effectiveJob {
+
+	job := effectiveJob{Name: config.Name}
+	job.Settings = effectiveSettings(config, configFields, config.source)
+	for _, s := range config.servers {
+		server := effectiveServer{
+			Name:     s.Name,
+			Settings: effectiveSettings(s, serverFields, s.source),
+		}
+		// selection settings not set for the server are those of the job
+		for i, setting := range server.Settings {
+			if setting.Source != "default" || findField(configFields, setting.Key) == nil {
+				continue
+			}
+			for _, js := range job.Settings {
+				if js.Key == setting.Key {
+					server.Settings[i] = effectiveSetting{Key: js.Key, Value: js.Value, Source: "job"}
+				}
+			}
+		}
+		job.Servers = append(job.Servers, server)
+	}
+	return job
+}
+
+// effectiveSettings returns the fields of the settings with their sources
+func effectiveSettings(config settings, fields []configField, source func(string) valueSource) []effectiveSetting {
+
+	var list []effectiveSetting
+	for i := range fields {
+		f := &fields[i]
+		src := source(f.Name)
+
+		var value any = reflect.ValueOf(config).Elem().FieldByName(f.Name).Interface()
+		if f.Type == fieldSecret {
+			value = f.get(config)
+		}
+
+		list = append(list, effectiveSetting{
+			Key:    f.Name,
+			Value:  value,
+			Source: src.Kind,
+			File:   src.File,
+			Line:   src.Line,
+			Name:   src.Name,
+		})
+	}
+	return list
+}
+
+func (report *effectiveConfig) print() {
+
+	fmt.Printf("# config file: %s (%s)\n", report.File, report.Picked)
+	for _, f := range report.Includes {
+		fmt.Printf("# includes: %s\n", f)
+	}
+	for _, w := range report.Warnings {
+		fmt.Printf("# warning: %s\n", w)
+	}
+
+	for _, job := range report.Jobs {
+		if job.Name != "" {
+			fmt.Printf("\n[job.%s]\n", job.Name)
+		}
+		printSettings(configFields, job.Settings)
+
+		for _, s := range job.Servers {
+			if job.Name != "" {
+				fmt.Printf("\n[job.%s.server.%s]\n", job.Name, s.Name)
+			} else {
+				fmt.Printf("\n[server.%s]\n", s.Name)
+			}
+			printSettings(serverFields, s.Settings)
+		}
+	}
+}
+
+func printSettings(fields []configField, list []effectiveSetting) {
+	for _, s := range list {
+		f := findField(fields, s.Key)
+		src := valueSource{Kind: s.Source, File: s.File, Line: s.Line, Name: s.Name}
+		fmt.Printf("%-17s = %-40s # %s\n", s.Key, formatConfigValue(f, fmt.Sprint(s.Value)), src)
+	}
+}
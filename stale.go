@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// A server whose backup schedule has stopped keeps the same newest backup,
+// which would be collected and archived on every run. MaxBackupAge, for
+// the job or a server section, reports such servers as stale:
+//
+//	MaxBackupAge = "2d"
+//
+//	[server."AS-Boiler"]
+//	MaxBackupAge = "8d"     # backed up weekly
+//
+// Stale servers are logged and listed in the summary of the run, and the
+// run exits with status 3 when no job failed.
+
+// ErrStaleBackups is returned when the jobs ran but a server is stale
+var ErrStaleBackups = errors.New("stale backups found")
+
+// staleServer is a server whose newest backup is older than MaxBackupAge
+type staleServer struct {
+	Name   string
+	Newest string
+	Age    time.Duration
+	Limit  time.Duration
+}
+
+func (s staleServer) String() string {
+	return fmt.Sprintf("server `%s` is stale, newest backup `%s` is %s old, MaxBackupAge is %s",
+		s.Name, filepath.Base(s.Newest), formatAge(s.Age.Truncate(time.Hour)), formatAge(s.Limit))
+}
+
+// maxBackupAge returns the MaxBackupAge of the server, that of the job
+// unless set in the server section
+func (config *configSettings) maxBackupAge(server *serverSettings) (time.Duration, error) {
+	if server.isSet("MaxBackupAge") {
+		return parseAge(server.MaxBackupAge)
+	}
+	return parseAge(config.MaxBackupAge)
+}
+
+// staleServers returns the servers in ESBackupPath whose newest backup is
+// older than their MaxBackupAge. skipped servers are not checked.
+func (config *configSettings) staleServers() ([]staleServer, error) {
+
+	newest := map[string]backupFile{}
+	err := filepath.Walk(config.ESBackupPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !IsFileXBK(path) {
+			return nil
+		}
+		name := config.serverOf(filepath.Dir(path))
+		if b, ok := newest[name]; !ok || info.ModTime().After(b.ModTime) {
+			newest[name] = backupFile{path, info.ModTime()}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var stale []staleServer
+	for name, b := range newest {
+		server := config.server(name)
+		if server.Skip {
+			continue
+		}
+		limit, err := config.maxBackupAge(server)
+		if err != nil {
+			return nil, fmt.Errorf("MaxBackupAge: %v", err)
+		}
+		if age := now.Sub(b.ModTime); limit > 0 && age > limit {
+			if name == "" {
+				name = config.ESBackupPath
+			}
+			stale = append(stale, staleServer{name, b.Path, age, limit})
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Name < stale[j].Name })
+	return stale, nil
+}
+
+// checkStale logs the stale servers of the job and records them for the
+// summary of the run
+func (config *configSettings) checkStale() error {
+
+	stale, err := config.staleServers()
+	if err != nil {
+		return err
+	}
+	for _, s := range stale {
+		log.Printf("warning: %s\n", s)
+	}
+	config.stale = stale
+	return nil
+}
+
+// printStale flags the stale servers of the job in list
+func (config *configSettings) printStale() {
+
+	stale, err := config.staleServers()
+	if err != nil {
+		log.Printf("Error checking for stale backups: %v\n", err)
+		return
+	}
+	for _, s := range stale {
+		fmt.Printf("# stale: %s\n", s)
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "check the configuration file without running a backup",
+	Run: func(cmd *cobra.Command, args []string) {
+		file, err := getConfigFile()
+		if err != nil {
+			fmt.Printf("error: config file '%s' not found\n", file)
+			os.Exit(1)
+		}
+
+		fmt.Printf("checking %s\n", file)
+		jobs, warnings, err := readConfig(file)
+
+		var v validation
+		for _, w := range warnings {
+			v.warn("", w.Error())
+		}
+		if err != nil {
+			// report every parse error, the settings are incomplete
+			for _, e := range splitErrors(err) {
+				v.fail("", e.Error())
+			}
+		} else {
+			validateJobs(jobs, &v)
+		}
+
+		v.print()
+		if v.errors > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// validation collects the problems found in a config
+type validation struct {
+	lines    []string
+	errors   int
+	warnings int
+	prefix   string
+}
+
+func (v *validation) fail(field, msg string) {
+	v.errors++
+	v.add("error", field, msg)
+}
+
+func (v *validation) warn(field, msg string) {
+	v.warnings++
+	v.add("warning", field, msg)
+}
+
+func (v *validation) add(level, field, msg string) {
+	if field != "" {
+		msg = field + ": " + msg
+	}
+	v.lines = append(v.lines, level+": "+v.prefix+msg)
+}
+
+func (v *validation) print() {
+	for _, l := range v.lines {
+		fmt.Println(l)
+	}
+	if v.errors == 0 && v.warnings == 0 {
+		fmt.Println("config ok")
+		return
+	}
+	fmt.Printf("%d error(s), %d warning(s)\n", v.errors, v.warnings)
+}
+
+// splitErrors returns the errors combined with errors.Join
+func splitErrors(err error) []error {
+	if j, ok := err.(interface{ Unwrap() []error }); ok {
+		return j.Unwrap()
+	}
+	return []error{err}
+}
+
+// validateJobs checks every job. jobs sharing a folder are rejected when
+// the config is read, see checkJobFolders.
+func validateJobs(jobs []*configSettings, v *validation) {
+
+	for _, job := range jobs {
+		if len(jobs) > 1 {
+			v.prefix = fmt.Sprintf("[job.%s] ", job.Name)
+		}
+		job.validate(v)
+	}
+	v.prefix = ""
+}
+
+// checkJobFolders tests that no two jobs share a backup or archive folder,
+// or use one inside the other, as each job removes the files it did not
+// create
+func checkJobFolders(jobs []*configSettings) error {
+
+	var errs []error
+	check := func(name, a, b string, ja, jb *configSettings) {
+		switch {
+		case a == "" || b == "":
+		case isSubPath(a, b) && isSubPath(b, a):
+			errs = append(errs, fmt.Errorf("%s: jobs `%s` and `%s` use the same folder", name, ja.jobName(), jb.jobName()))
+		case isSubPath(a, b):
+			errs = append(errs, fmt.Errorf("%s: the folder of job `%s` is inside that of job `%s`", name, jb.jobName(), ja.jobName()))
+		case isSubPath(b, a):
+			errs = append(errs, fmt.Errorf("%s: the folder of job `%s` is inside that of job `%s`", name, ja.jobName(), jb.jobName()))
+		}
+	}
+
+	for i, a := range jobs {
+		for _, b := range jobs[i+1:] {
+			check("BackupFolder", a.BackupFolder, b.BackupFolder, a, b)
+			if a.Archive && b.Archive {
+				check("ArchiveFolder", a.ArchiveFolder, b.ArchiveFolder, a, b)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the settings and reports every problem found
+func (config *configSettings) validate(v *validation) {
+
+	config.validateESBackupPath(v)
+
+	if _, err := parseServerKind(config.ServerKind); err != nil {
+		v.fail("ServerKind", err.Error())
+	}
+
+	if config.BackupFolder == "" {
+		v.fail("BackupFolder", "not set")
+	} else if err := checkWritable(config.BackupFolder); err != nil {
+		v.fail("BackupFolder", err.Error())
+	}
+
+	if config.Archive {
+		if config.ArchiveFolder == "" {
+			v.fail("ArchiveFolder", "not set, required when Archive is true")
+		} else if err := checkWritable(config.ArchiveFolder); err != nil {
+			v.fail("ArchiveFolder", err.Error())
+		}
+		if config.ArchiveName == "" {
+			v.warn("ArchiveName", "not set, archive files will have no name")
+		}
+	}
+
+	// the backup folder is cleaned of old backups and the archive folder
+	// of old archives, so neither may contain the other or the ES backups
+	folders := []struct{ name, path string }{
+		{"ESBackupPath", config.ESBackupPath},
+		{"BackupFolder", config.BackupFolder},
+	}
+	if config.Archive {
+		folders = append(folders, struct{ name, path string }{"ArchiveFolder", config.ArchiveFolder})
+	}
+	for i, a := range folders {
+		for _, b := range folders[i+1:] {
+			if a.path == "" || b.path == "" {
+				continue
+			}
+			switch {
+			case isSubPath(a.path, b.path) && isSubPath(b.path, a.path):
+				v.fail(b.name, fmt.Sprintf("is the same folder as %s", a.name))
+			case isSubPath(a.path, b.path):
+				v.fail(b.name, fmt.Sprintf("is inside %s", a.name))
+			case isSubPath(b.path, a.path):
+				v.fail(a.name, fmt.Sprintf("is inside %s", b.name))
+			}
+		}
+	}
+
+	if config.ArchiveCount < 0 {
+		v.fail("ArchiveCount", fmt.Sprintf("%d is negative, use 0 to keep all archives", config.ArchiveCount))
+	}
+
+	config.validateNames(v)
+	validatePolicy(config, nil, "", v)
+	if _, err := parseAge(config.MaxBackupAge); err != nil {
+		v.fail("MaxBackupAge", err.Error())
+	}
+	if _, err := parseArtifacts(config.Artifacts); err != nil {
+		v.fail("Artifacts", err.Error())
+	}
+	if config.Artifacts != "" && config.PreserveStructure && config.ESBackupPath != "" {
+		if info, err := os.Stat(filepath.Join(config.ESBackupPath, artifactsFolder)); err == nil && info.IsDir() {
+			v.fail("Artifacts", fmt.Sprintf("ESBackupPath has a server folder `%s`, its backups would be collected in the artifacts folder", artifactsFolder))
+		}
+	}
+	config.validateServers(v)
+
+	if config.Ftp && config.FtpUri == "" {
+		v.fail("FtpUri", "not set, required when Ftp is true")
+	}
+
+	if config.FtpPass.Ref != "" && !config.FtpPass.IsRef() {
+		v.warn("FtpPass", fmt.Sprintf("stored as plain text, use `%s secret set` to encrypt it", exeName))
+	}
+	if _, err := config.FtpPass.Resolve(); err != nil {
+		if config.Ftp {
+			v.fail("FtpPass", err.Error())
+		} else {
+			v.warn("FtpPass", err.Error())
+		}
+	}
+
+	if config.FtpWeekday != "" && !isWeekday(strings.ToLower(strings.TrimSpace(config.FtpWeekday))) {
+		v.fail("FtpWeekday", fmt.Sprintf("%q is not a weekday, the upload never runs", config.FtpWeekday))
+	}
+}
+
+// validateServers checks the server settings. a server without a folder
+// in ESBackupPath may be retired.
+func (config *configSettings) validateServers(v *validation) {
+
+	friendly := map[string]string{}
+	for _, s := range config.servers {
+		field := fmt.Sprintf("[server.%s] ", s.Name)
+
+		validatePolicy(config, s, field, v)
+		if _, err := parseAge(s.MaxBackupAge); err != nil {
+			v.fail(field+"MaxBackupAge", err.Error())
+		}
+		if s.FriendlyName != "" {
+			if strings.ContainsAny(s.FriendlyName, `/\:*?"<>|`) {
+				v.fail(field+"FriendlyName", fmt.Sprintf("%q is not a valid folder name", s.FriendlyName))
+			}
+			if config.Artifacts != "" && strings.EqualFold(s.FriendlyName, artifactsFolder) {
+				v.fail(field+"FriendlyName", fmt.Sprintf("%q is the folder of the artifacts in the archive", s.FriendlyName))
+			}
+			if other, ok := friendly[strings.ToLower(s.FriendlyName)]; ok {
+				v.fail(field+"FriendlyName", fmt.Sprintf("%q is also used by server %q", s.FriendlyName, other))
+			}
+			friendly[strings.ToLower(s.FriendlyName)] = s.Name
+		}
+
+		if config.ESBackupPath == "" {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(config.ESBackupPath, s.Name)); err != nil || !info.IsDir() {
+			v.warn("", field+fmt.Sprintf("no folder `%s` in ESBackupPath", s.Name))
+		}
+	}
+}
+
+// validatePolicy checks the backup selection of the job, or of a server
+// when server is not nil. errors in the job settings are only reported for
+// the job.
+func validatePolicy(config *configSettings, server *serverSettings, field string, v *validation) {
+	if server != nil {
+		if _, err := config.policy(nil); err != nil {
+			return
+		}
+	}
+	p, err := config.policy(server)
+	switch {
+	case err != nil:
+		for _, e := range splitErrors(err) {
+			v.fail("", field+e.Error())
+		}
+	case p.Count == 0 && p.MaxAge == 0 && !p.Scheduled && (server == nil || server.isSet("BackupCount") || server.isSet("BackupNewerThan")):
+		v.warn("", field+"BackupCount 0 without a BackupNewerThan or BackupTime collects every backup")
+	}
+}
+
+// validateNames checks the archive and ftp name templates, and the name
+// flags that are ignored by a template
+func (config *configSettings) validateNames(v *validation) {
+
+	now := time.Now()
+	ftpName := config.FtpName
+	if ftpName == "" {
+		ftpName = config.ArchiveName
+	}
+
+	if config.Archive {
+		if _, err := expandTemplate(config.archiveTemplate(), config.nameToken(now)); err != nil {
+			v.fail("ArchiveName", err.Error())
+		}
+	}
+	if config.Ftp {
+		if _, err := expandTemplate(config.ftpTemplate(".zip"), config.nameToken(now)); err != nil {
+			v.fail("FtpName", err.Error())
+		}
+	}
+
+	if isTemplate(config.ArchiveName) {
+		for _, flag := range []struct {
+			name string
+			set  bool
+		}{
+			{"ArchiveISOWeek", config.ArchiveISOWeek},
+			{"ArchiveWeekday", config.ArchiveWeekday},
+			{"ArchiveAddYear", config.ArchiveAddYear},
+			{"ArchiveAddMonth", config.ArchiveAddMonth},
+		} {
+			if flag.set {
+				v.warn(flag.name, "ignored, ArchiveName is a template")
+			}
+		}
+	} else if config.ArchiveISOWeek && config.ArchiveWeekday {
+		v.fail("ArchiveWeekday", "cannot be used with ArchiveISOWeek, the weekday is ignored")
+	}
+
+	if isTemplate(ftpName) {
+		if config.FtpAddYear {
+			v.warn("FtpAddYear", "ignored, FtpName is a template")
+		}
+		if config.FtpAddMonth {
+			v.warn("FtpAddMonth", "ignored, FtpName is a template")
+		}
+	}
+}
+
+func (config *configSettings) validateESBackupPath(v *validation) {
+
+	if config.ESBackupPath == "" {
+		v.fail("ESBackupPath", "not set")
+		return
+	}
+
+	info, err := os.Stat(config.ESBackupPath)
+	if err != nil {
+		v.fail("ESBackupPath", err.Error())
+		return
+	}
+	if !info.IsDir() {
+		v.fail("ESBackupPath", fmt.Sprintf("`%s` is not a folder", config.ESBackupPath))
+		return
+	}
+
+	count := 0
+	err = filepath.WalkDir(config.ESBackupPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && IsFileXBK(path) {
+			count++
+		}
+		return nil
+	})
+	switch {
+	case err != nil:
+		v.fail("ESBackupPath", err.Error())
+	case count == 0:
+		v.fail("ESBackupPath", fmt.Sprintf("no %s backup files found in `%s`", Ext, config.ESBackupPath))
+	}
+}
+
+// checkWritable tests that files can be created in the folder. a missing
+// folder is checked at the closest parent that exists, as it is created
+// when the backup runs.
+func checkWritable(dir string) error {
+
+	path := filepath.Clean(dir)
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("`%s` is not a folder", path)
+			}
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return fmt.Errorf("`%s` cannot be created", dir)
+		}
+		path = parent
+	}
+
+	f, err := os.CreateTemp(path, ".ebobackup-*")
+	if err != nil {
+		return fmt.Errorf("`%s` is not writable: %v", path, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// isSubPath tests if path is inside or the same as parent. paths are
+// compared without case as on Windows.
+func isSubPath(parent, path string) bool {
+	p, err := filepath.Abs(parent)
+	if err != nil {
+		return false
+	}
+	c, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(strings.ToLower(p), strings.ToLower(c))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isWeekday(day string) bool {
+	for d := 0; d < 7; d++ {
+		if strings.ToLower(time.Weekday(d).String()) == day {
+			return true
+		}
+	}
+	return false
+}
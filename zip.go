@@ -15,50 +15,64 @@ Param 1: filename is the output zip file's name.
 Param 2: files is a list of files to add to the zip.
 */
 func ZipFiles(filename string, files []string) error {
+	return ZipFilesAs(filename, files, filepath.Base)
+}
+
+// ZipFilesAs compresses the files into a zip archive with the names
+// returned by name
+func ZipFilesAs(filename string, files []string, name func(file string) string) error {
 
 	newZipFile, err := os.Create(filename)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer newZipFile.Close()
 
 	zipWriter := zip.NewWriter(newZipFile)
-	defer zipWriter.Close()
 
 	// Add files to zip
 	for _, file := range files {
-		log.Printf("adding `%s` to archive\n", filepath.Base(file))
-		if err = addFileToZip(zipWriter, file); err != nil {
-			log.Fatal(err)
+		log.Printf("adding `%s` to archive\n", name(file))
+		if err = addFileToZip(zipWriter, file, name(file)); err != nil {
+			break
 		}
 	}
-	return nil
+
+	// each is closed once, the zip writer first as it writes the
+	// directory at the end of the file
+	if cerr := zipWriter.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := newZipFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
-func addFileToZip(zipWriter *zip.Writer, filename string) error {
+func addFileToZip(zipWriter *zip.Writer, filename string, name string) error {
 
 	fileToZip, err := os.Open(filename)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer fileToZip.Close()
 
 	// Get the file information
 	info, err := fileToZip.Stat()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	header, err := zip.FileInfoHeader(info)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
+	header.Name = name
 	header.Method = zip.Deflate
 
 	writer, err := zipWriter.CreateHeader(header)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	_, err = io.Copy(writer, fileToZip)